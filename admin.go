@@ -0,0 +1,465 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	authBearerPrefix    = "Bearer "
+
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type adminConfig struct {
+	// Path is the url path prefix of the admin endpoints.
+	Path string `json:"path"`
+
+	// Token is the bearer token of the admin endpoints.
+	// The admin endpoints are not served if it is empty.
+	Token string `json:"token"`
+}
+
+func (cfg *adminConfig) SetDefault() {
+	if cfg.Path == "" {
+		cfg.Path = "/admin"
+	}
+}
+
+type repoRequest struct {
+	Owner    string `json:"owner"`
+	RepoId   string `json:"repo_id"`
+	RepoName string `json:"repo_name"`
+	Ref      string `json:"ref"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+func (req *repoRequest) toRepoInfo() (info sync.RepoInfo, err error) {
+	if req.RepoId == "" || req.RepoName == "" {
+		err = errors.New("missing repo_id or repo_name")
+
+		return
+	}
+
+	if info.Owner, err = domain.NewAccount(req.Owner); err != nil {
+		return
+	}
+
+	info.RepoId = req.RepoId
+	info.RepoName = req.RepoName
+	info.Ref = req.Ref
+
+	return
+}
+
+type lockView struct {
+	Owner      string `json:"owner"`
+	RepoId     string `json:"repo_id"`
+	Ref        string `json:"ref"`
+	Status     string `json:"status"`
+	Version    int    `json:"version"`
+	LastCommit string `json:"last_commit"`
+	RepoType   string `json:"repo_type"`
+	Failures   int    `json:"failures"`
+	LastError  string `json:"last_error"`
+	Holder     string `json:"holder"`
+	Expiry     int64  `json:"expiry"`
+}
+
+func toLockView(c *domain.RepoSyncLock) lockView {
+	v := lockView{
+		RepoId:     c.RepoId,
+		Ref:        c.Ref,
+		Version:    c.Version,
+		LastCommit: c.LastCommit,
+		Failures:   c.Failures,
+		LastError:  c.LastError,
+		Holder:     c.Holder,
+		Expiry:     c.Expiry,
+	}
+
+	if c.Owner != nil {
+		v.Owner = c.Owner.Account()
+	}
+
+	if c.Status != nil {
+		v.Status = c.Status.RepoSyncStatus()
+	}
+
+	if c.RepoType != nil {
+		v.RepoType = c.RepoType.ResourceType()
+	}
+
+	return v
+}
+
+func newAdminHandler(cfg *adminConfig, s sync.AdminService, log *logrus.Entry) *adminHandler {
+	return &adminHandler{
+		cfg:     *cfg,
+		service: s,
+		log:     log,
+	}
+}
+
+type adminHandler struct {
+	cfg     adminConfig
+	service sync.AdminService
+	log     *logrus.Entry
+}
+
+func (h *adminHandler) register(mux *http.ServeMux) {
+	mux.Handle(h.cfg.Path+"/locks", h.handle(http.MethodGet, h.listLocks))
+	mux.Handle(h.cfg.Path+"/lock", h.handle(http.MethodGet, h.getLock))
+	mux.Handle(h.cfg.Path+"/unlock", h.handle(http.MethodPost, h.unlock))
+	mux.Handle(h.cfg.Path+"/unblock", h.handle(http.MethodPost, h.unblock))
+	mux.Handle(h.cfg.Path+"/sync", h.handle(http.MethodPost, h.triggerSync))
+	mux.Handle(h.cfg.Path+"/reconcile", h.handle(http.MethodPost, h.reconcile))
+	mux.Handle(h.cfg.Path+"/reconcile/status", h.handle(http.MethodGet, h.getReconcile))
+	mux.Handle(h.cfg.Path+"/histories", h.handle(http.MethodGet, h.listHistories))
+}
+
+// handle checks the method and token before calling f which returns
+// the status code and the body of response.
+func (h *adminHandler) handle(
+	method string, f func(*http.Request) (int, interface{}, error),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if !h.isAuthorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		code, data, err := f(r)
+		if err != nil {
+			h.log.Errorf("handle admin request %s failed, err:%s", r.URL.Path, err.Error())
+
+			http.Error(w, err.Error(), code)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+
+		if data != nil {
+			if err := json.NewEncoder(w).Encode(data); err != nil {
+				h.log.Errorf("write admin response failed, err:%s", err.Error())
+			}
+		}
+	})
+}
+
+func (h *adminHandler) isAuthorized(r *http.Request) bool {
+	v := r.Header.Get(headerAuthorization)
+
+	return subtle.ConstantTimeCompare([]byte(v), []byte(authBearerPrefix+h.cfg.Token)) == 1
+}
+
+func (h *adminHandler) listLocks(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+
+	offset, limit, err := parsePage(q.Get("offset"), q.Get("limit"))
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	v, err := h.service.ListLocks(&synclock.ListOption{
+		Owner:  q.Get("owner"),
+		Status: q.Get("status"),
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	locks := make([]lockView, len(v))
+	for i := range v {
+		locks[i] = toLockView(&v[i])
+	}
+
+	return http.StatusOK, locks, nil
+}
+
+func (h *adminHandler) getLock(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+
+	owner, err := domain.NewAccount(q.Get("owner"))
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	c, err := h.service.GetLock(owner, q.Get("repo_id"), q.Get("ref"))
+	if err != nil {
+		return lockErrorCode(err), nil, err
+	}
+
+	return http.StatusOK, toLockView(&c), nil
+}
+
+func (h *adminHandler) unlock(r *http.Request) (int, interface{}, error) {
+	req := new(repoRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	owner, err := domain.NewAccount(req.Owner)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	c, err := h.service.ForceUnlock(owner, req.RepoId, req.Ref)
+	if err != nil {
+		return lockErrorCode(err), nil, err
+	}
+
+	h.log.Warnf("force unlock the sync of repo %s/%s@%s", req.Owner, req.RepoId, req.Ref)
+
+	return http.StatusOK, toLockView(&c), nil
+}
+
+func (h *adminHandler) unblock(r *http.Request) (int, interface{}, error) {
+	req := new(repoRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	owner, err := domain.NewAccount(req.Owner)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	c, err := h.service.Unblock(owner, req.RepoId, req.Ref)
+	if err != nil {
+		return lockErrorCode(err), nil, err
+	}
+
+	h.log.Infof("unblock the sync of repo %s/%s@%s", req.Owner, req.RepoId, req.Ref)
+
+	// the pushes skipped while it is blocked are synced by a new sync, which
+	// needs the repo name.
+	if req.RepoName != "" {
+		if info, err := req.toRepoInfo(); err == nil {
+			h.service.TriggerSync(&info)
+		}
+	}
+
+	return http.StatusOK, toLockView(&c), nil
+}
+
+func (h *adminHandler) triggerSync(r *http.Request) (int, interface{}, error) {
+	_, info, err := decodeRepoRequest(r)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	h.service.TriggerSync(&info)
+
+	return http.StatusAccepted, nil, nil
+}
+
+func (h *adminHandler) reconcile(r *http.Request) (int, interface{}, error) {
+	req, info, err := decodeRepoRequest(r)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	// the reconcile compares the whole tree of repo, so it may take a long
+	// time. The status of job is polled by the id.
+	job, err := h.service.StartReconcile(&info, req.DryRun)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	h.log.Infof("start the reconcile(%s) of repo %s", job.Id, job.Repo)
+
+	return http.StatusAccepted, toReconcileJobView(&job), nil
+}
+
+func (h *adminHandler) getReconcile(r *http.Request) (int, interface{}, error) {
+	job, ok := h.service.GetReconcile(r.URL.Query().Get("id"))
+	if !ok {
+		return http.StatusNotFound, nil, errors.New("reconcile job not found")
+	}
+
+	return http.StatusOK, toReconcileJobView(&job), nil
+}
+
+type reconcileJobView struct {
+	Id         string   `json:"id"`
+	Repo       string   `json:"repo"`
+	DryRun     bool     `json:"dry_run"`
+	Status     string   `json:"status"`
+	StartTime  int64    `json:"start_time"`
+	EndTime    int64    `json:"end_time,omitempty"`
+	LastCommit string   `json:"last_commit,omitempty"`
+	Missing    []string `json:"missing,omitempty"`
+	Changed    []string `json:"changed,omitempty"`
+	Orphaned   []string `json:"orphaned,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+func toReconcileJobView(job *sync.ReconcileJob) reconcileJobView {
+	v := reconcileJobView{
+		Id:         job.Id,
+		Repo:       job.Repo,
+		DryRun:     job.DryRun,
+		Status:     "running",
+		StartTime:  job.StartTime,
+		EndTime:    job.EndTime,
+		LastCommit: job.Result.LastCommit,
+		Missing:    job.Result.Missing,
+		Changed:    job.Result.Changed,
+		Orphaned:   job.Result.Orphaned,
+		Error:      job.Error,
+	}
+
+	if job.Done {
+		if job.Error == "" {
+			v.Status = "succeeded"
+		} else {
+			v.Status = "failed"
+		}
+	}
+
+	return v
+}
+
+type historyView struct {
+	Owner      string   `json:"owner"`
+	RepoId     string   `json:"repo_id"`
+	Ref        string   `json:"ref"`
+	StartTime  int64    `json:"start_time"`
+	EndTime    int64    `json:"end_time"`
+	FromCommit string   `json:"from_commit"`
+	ToCommit   string   `json:"to_commit"`
+	Added      int      `json:"added"`
+	Modified   int      `json:"modified"`
+	Deleted    int      `json:"deleted"`
+	LFSCopied  int      `json:"lfs_copied"`
+	Bytes      int64    `json:"bytes"`
+	Outcome    string   `json:"outcome"`
+	Error      string   `json:"error,omitempty"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+func toHistoryView(v *domain.SyncHistory) historyView {
+	return historyView{
+		Owner:      v.Owner.Account(),
+		RepoId:     v.RepoId,
+		Ref:        v.Ref,
+		StartTime:  v.StartTime,
+		EndTime:    v.EndTime,
+		FromCommit: v.FromCommit,
+		ToCommit:   v.ToCommit,
+		Added:      v.Added,
+		Modified:   v.Modified,
+		Deleted:    v.Deleted,
+		LFSCopied:  v.LFSCopied,
+		Bytes:      v.Bytes,
+		Outcome:    v.Outcome.SyncOutcome(),
+		Error:      v.Error,
+		Mismatches: v.Mismatches,
+	}
+}
+
+type historiesView struct {
+	Total     int           `json:"total"`
+	Histories []historyView `json:"histories"`
+}
+
+func (h *adminHandler) listHistories(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+
+	offset, limit, err := parsePage(q.Get("offset"), q.Get("limit"))
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	opt := synchistory.ListOption{
+		Owner:  q.Get("owner"),
+		RepoId: q.Get("repo_id"),
+		Offset: offset,
+		Limit:  limit,
+	}
+
+	// the empty ref is the default branch, so it filters if it is present.
+	if _, ok := q["ref"]; ok {
+		ref := q.Get("ref")
+		opt.Ref = &ref
+	}
+
+	v, total, err := h.service.ListHistories(&opt)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	histories := make([]historyView, len(v))
+	for i := range v {
+		histories[i] = toHistoryView(&v[i])
+	}
+
+	return http.StatusOK, historiesView{Total: total, Histories: histories}, nil
+}
+
+func decodeRepoRequest(r *http.Request) (req repoRequest, info sync.RepoInfo, err error) {
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return
+	}
+
+	info, err = req.toRepoInfo()
+
+	return
+}
+
+func lockErrorCode(err error) int {
+	if synclock.IsRepoSyncLockNotExist(err) {
+		return http.StatusNotFound
+	}
+
+	if domain.IsInvalidTransition(err) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+func parsePage(offset, limit string) (o int, l int, err error) {
+	if offset != "" {
+		if o, err = strconv.Atoi(offset); err != nil || o < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+
+	l = defaultPageLimit
+	if limit != "" {
+		if l, err = strconv.Atoi(limit); err != nil || l <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+	}
+
+	if l > maxPageLimit {
+		l = maxPageLimit
+	}
+
+	return
+}
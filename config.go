@@ -1,11 +1,10 @@
 package main
 
 import (
+	"errors"
+
 	"github.com/opensourceways/community-robot-lib/utils"
 
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/mysql"
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/obsimpl"
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/platformimpl"
 	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
 )
 
@@ -18,21 +17,43 @@ type configSetDefault interface {
 }
 
 type configuration struct {
-	// AccessEndpoint is used to send back the message.
-	AccessEndpoint string              `json:"access_endpoint" required:"true"`
-	AccessHmac     string              `json:"access_hmac"     required:"true"`
-	OBS            obsimpl.Config      `json:"obs"             required:"true"`
-	Sync           sync.Config         `json:"sync"            required:"true"`
-	Mysql          mysql.Config        `json:"mysql"           required:"true"`
-	Gitlab         platformimpl.Config `json:"gitlab"          required:"true"`
+	storageConfig
+
+	platformConfig
+
+	databaseConfig
+
+	lockConfig
+
+	Sync       sync.Config      `json:"sync"        required:"true"`
+	SystemHook systemHookConfig `json:"system_hook"`
+	Admin      adminConfig      `json:"admin"`
 }
 
 func (cfg *configuration) configItems() []interface{} {
 	return []interface{}{
 		&cfg.Sync,
-		&cfg.OBS,
-		&cfg.Gitlab,
-		&cfg.Mysql,
+		&cfg.storageConfig,
+		&cfg.platformConfig,
+		&cfg.databaseConfig,
+		&cfg.lockConfig,
+		&cfg.SystemHook,
+		&cfg.Admin,
+	}
+}
+
+type systemHookConfig struct {
+	// Path is the url path to receive the system hooks of gitlab.
+	Path string `json:"path"`
+
+	// Token is the secret token of system hooks.
+	// The system hooks are not handled if it is empty.
+	Token string `json:"token"`
+}
+
+func (cfg *systemHookConfig) SetDefault() {
+	if cfg.Path == "" {
+		cfg.Path = "/gitlab-system-hook"
 	}
 }
 
@@ -41,6 +62,10 @@ func (cfg *configuration) validate() error {
 		return err
 	}
 
+	if err := cfg.validateEngine(); err != nil {
+		return err
+	}
+
 	items := cfg.configItems()
 
 	for _, i := range items {
@@ -54,6 +79,16 @@ func (cfg *configuration) validate() error {
 	return nil
 }
 
+// validateEngine checks the storage of the shell engine which uploads the
+// files by obsutil, so it can't work with the other storages.
+func (cfg *configuration) validateEngine() error {
+	if cfg.Sync.IsShellEngine() && cfg.Storage != storageOBS {
+		return errors.New("the shell engine of sync only works with obs storage")
+	}
+
+	return nil
+}
+
 func (cfg *configuration) setDefault() {
 	items := cfg.configItems()
 
@@ -62,6 +97,13 @@ func (cfg *configuration) setDefault() {
 			v.SetDefault()
 		}
 	}
+
+	// the shell engine uploads to the same bucket of obs storage. They are
+	// not taken from the obs section which is left when the storage is not obs.
+	if cfg.Storage == storageOBS && cfg.OBS != nil {
+		cfg.Sync.OBSUtilPath = cfg.OBS.OBSUtilPath
+		cfg.Sync.OBSBucket = cfg.OBS.Bucket
+	}
 }
 
 func loadConfig(file string) (cfg configuration, err error) {
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/obsimpl"
+)
+
+func TestShellEngineStorage(t *testing.T) {
+	obs := &obsimpl.Config{OBSUtilPath: "/usr/bin/obsutil", Bucket: "bucket"}
+
+	cases := []struct {
+		storage string
+		valid   bool
+		bucket  string
+	}{
+		{storageOBS, true, "bucket"},
+		{storageS3, false, ""},
+		{storageLocal, false, ""},
+	}
+
+	for _, c := range cases {
+		cfg := configuration{}
+		cfg.Storage = c.storage
+		cfg.OBS = obs
+		cfg.Sync.Engine = "shell"
+
+		cfg.setDefault()
+
+		if err := cfg.validateEngine(); (err == nil) != c.valid {
+			t.Errorf("validate the shell engine with %s: %v", c.storage, err)
+		}
+
+		// the obs section is not used by the other storages.
+		if cfg.Sync.OBSBucket != c.bucket {
+			t.Errorf("bucket of shell engine with %s = %q", c.storage, cfg.Sync.OBSBucket)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/sqldb"
+)
+
+const (
+	databaseMysql      = "mysql"
+	databasePostgreSQL = "postgresql"
+	databaseSQLite     = "sqlite"
+)
+
+type databaseConfig struct {
+	// Database is the database which saves the sync locks, tasks and
+	// histories, mysql, postgresql or sqlite. Default is mysql.
+	Database string `json:"database"`
+
+	// Only the one of Database is required. SQLite is for the small
+	// deployment and testing.
+	Mysql      *sqldb.Config `json:"mysql"`
+	PostgreSQL *sqldb.Config `json:"postgresql"`
+	SQLite     *sqldb.Config `json:"sqlite"`
+
+	// SkipMigration disables the migration at startup, then the schema
+	// must be upgraded by the migrate command before. The instances of the
+	// version without migrations must all be stopped before upgrading, it
+	// can't be rolling, because they can't read the new statuses of locks.
+	SkipMigration bool `json:"skip_migration"`
+}
+
+func (cfg *databaseConfig) config() *sqldb.Config {
+	switch cfg.Database {
+	case databasePostgreSQL:
+		return cfg.PostgreSQL
+
+	case databaseSQLite:
+		return cfg.SQLite
+
+	default:
+		return cfg.Mysql
+	}
+}
+
+func (cfg *databaseConfig) SetDefault() {
+	if cfg.Database == "" {
+		cfg.Database = databaseMysql
+	}
+
+	if v := cfg.config(); v != nil {
+		v.SetDefault()
+	}
+}
+
+func (cfg *databaseConfig) Validate() error {
+	switch cfg.Database {
+	case databaseMysql, databasePostgreSQL, databaseSQLite:
+	default:
+		return errors.New("unknown database")
+	}
+
+	if cfg.config() == nil {
+		return errors.New("missing the config of " + cfg.Database)
+	}
+
+	return nil
+}
+
+func newDatabase(cfg *databaseConfig) (*sqldb.Client, error) {
+	switch cfg.Database {
+	case databasePostgreSQL:
+		return sqldb.NewPostgreSQL(cfg.PostgreSQL)
+
+	case databaseSQLite:
+		return sqldb.NewSQLite(cfg.SQLite)
+
+	default:
+		return sqldb.NewMysql(cfg.Mysql)
+	}
+}
+
+// migrateDatabase upgrades the schema unless it is skipped.
+func migrateDatabase(cfg *databaseConfig, db *sqldb.Client, log *logrus.Entry) error {
+	if cfg.SkipMigration {
+		return nil
+	}
+
+	v, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("the schema of database is at version %d", v)
+
+	return nil
+}
@@ -14,6 +14,10 @@ const (
 
 var (
 	reName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+	ResourceTypeProject = dpResourceType(resourceProject)
+	ResourceTypeDataset = dpResourceType(resourceDataset)
+	ResourceTypeModel   = dpResourceType(resourceModel)
 )
 
 // Account
@@ -34,3 +38,27 @@ type dpAccount string
 func (r dpAccount) Account() string {
 	return string(r)
 }
+
+// ResourceType is the type of repo, project, dataset or model.
+type ResourceType interface {
+	ResourceType() string
+}
+
+func NewResourceType(v string) (ResourceType, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	switch v {
+	case resourceProject, resourceDataset, resourceModel:
+		return dpResourceType(v), nil
+	}
+
+	return nil, errors.New("invalid resource type")
+}
+
+type dpResourceType string
+
+func (r dpResourceType) ResourceType() string {
+	return string(r)
+}
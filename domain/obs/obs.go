@@ -1,9 +1,37 @@
 package obs
 
+type ObjectMeta struct {
+	Path string
+	Size int64
+	ETag string
+}
+
+// Checkpoint is the file where the progress of multipart upload is saved.
+// The progress is resumed only for the same Version of content, such as the
+// sha of git blob, no matter where the local file is.
+type Checkpoint struct {
+	File    string
+	Version string
+}
+
+// Limiter blocks until n bytes can be sent.
+type Limiter interface {
+	Wait(n int64)
+}
+
 type OBS interface {
 	SaveObject(path, content string) error
+	// UploadFile uploads the local file by streaming. The large file is
+	// uploaded by multipart and the progress is saved in the checkpoint,
+	// so that the upload is resumed when it is called again with the same
+	// checkpoint, even by the later sync. The bytes are charged to limiter
+	// as they are read from the file.
+	UploadFile(path, file string, cp Checkpoint, limiter Limiter) error
 	GetObject(path string) ([]byte, error)
+	// GetObjectMeta returns nil if the object does not exist.
+	GetObjectMeta(path string) (*ObjectMeta, error)
 	CopyObject(dst, src string) error
-	OBSUtilPath() string
-	OBSBucket() string
+	DeleteObject(path string) error
+	// ListObjects returns all the objects whose path starts with prefix.
+	ListObjects(prefix string) ([]ObjectMeta, error)
 }
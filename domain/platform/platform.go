@@ -1,6 +1,31 @@
 package platform
 
+import "github.com/opensourceways/robot-gitlab-sync-repo/domain"
+
+// Repo is the repo on platform. Id is immutable, while Owner and Name
+// change when the repo is renamed or transferred.
+type Repo struct {
+	Id    string
+	Owner string
+	Name  string
+}
+
+// Credential is used to clone the repos.
+type Credential struct {
+	Username string
+	Password string
+}
+
 type Platform interface {
-	GetLastCommit(pid string) (string, error)
+	// GetLastCommit returns the last commit of ref which is the full name
+	// of branch or tag. It is the default branch if ref is empty.
+	GetLastCommit(repo *Repo, ref string) (string, error)
+	// GetCloneURL returns the url without credential.
 	GetCloneURL(owner, repo string) string
+	GetCredential() Credential
+	// GetRepoOwner returns the namespace of repo.
+	GetRepoOwner(pid string) (string, error)
+	// GetRepoType returns the resource type of repo, and it is nil if
+	// the repo is not marked with any type.
+	GetRepoType(repo *Repo) (domain.ResourceType, error)
 }
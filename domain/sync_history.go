@@ -0,0 +1,62 @@
+package domain
+
+import "errors"
+
+const (
+	syncOutcomeSucceeded = "succeeded"
+	syncOutcomeFailed    = "failed"
+	syncOutcomeSkipped   = "skipped"
+)
+
+var (
+	SyncOutcomeSucceeded = syncOutcome(syncOutcomeSucceeded)
+	SyncOutcomeFailed    = syncOutcome(syncOutcomeFailed)
+	SyncOutcomeSkipped   = syncOutcome(syncOutcomeSkipped)
+)
+
+// SyncOutcome
+type SyncOutcome interface {
+	SyncOutcome() string
+	IsSucceeded() bool
+}
+
+func NewSyncOutcome(s string) (SyncOutcome, error) {
+	if s != syncOutcomeSucceeded && s != syncOutcomeFailed && s != syncOutcomeSkipped {
+		return nil, errors.New("invalid sync outcome")
+	}
+
+	return syncOutcome(s), nil
+}
+
+type syncOutcome string
+
+func (s syncOutcome) SyncOutcome() string {
+	return string(s)
+}
+
+func (s syncOutcome) IsSucceeded() bool {
+	return string(s) == syncOutcomeSucceeded
+}
+
+// SyncHistory is an attempt to sync the ref of repo. The time is unix time.
+type SyncHistory struct {
+	Id         string
+	Owner      Account
+	RepoId     string
+	Ref        string
+	StartTime  int64
+	EndTime    int64
+	FromCommit string
+	ToCommit   string
+	Added      int
+	Modified   int
+	Deleted    int
+	LFSCopied  int
+	Bytes      int64
+	Outcome    SyncOutcome
+	Error      string
+
+	// Mismatches is the objects which are not same as the files after
+	// sync, like "path: reason".
+	Mismatches []string
+}
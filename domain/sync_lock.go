@@ -1,21 +1,63 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
-	repoSyncStatusDone    = "done"
-	repoSyncStatusRunning = "running"
+	repoSyncStatusPending   = "pending"
+	repoSyncStatusRunning   = "running"
+	repoSyncStatusSucceeded = "succeeded"
+	repoSyncStatusFailed    = "failed"
+	repoSyncStatusBlocked   = "blocked"
+
+	// repoSyncStatusDone is saved by the old versions, which means the
+	// last sync has finished and it is treated as succeeded.
+	repoSyncStatusDone = "done"
 )
 
 var (
-	RepoSyncStatusDone    = repoSyncStatus(repoSyncStatusDone)
-	RepoSyncStatusRunning = repoSyncStatus(repoSyncStatusRunning)
+	RepoSyncStatusPending   = repoSyncStatus(repoSyncStatusPending)
+	RepoSyncStatusRunning   = repoSyncStatus(repoSyncStatusRunning)
+	RepoSyncStatusSucceeded = repoSyncStatus(repoSyncStatusSucceeded)
+	RepoSyncStatusFailed    = repoSyncStatus(repoSyncStatusFailed)
+	RepoSyncStatusBlocked   = repoSyncStatus(repoSyncStatusBlocked)
 )
 
+// repoSyncTransitions is the statuses which a status can transit to.
+// A running sync can be taken over by the other one after it expires,
+// and it turns to pending if it is aborted without the result.
+// The blocked one must be unblocked before syncing again.
+var repoSyncTransitions = map[string][]string{
+	repoSyncStatusPending: {repoSyncStatusRunning},
+	repoSyncStatusRunning: {
+		repoSyncStatusRunning, repoSyncStatusSucceeded, repoSyncStatusFailed,
+		repoSyncStatusBlocked, repoSyncStatusPending,
+	},
+	repoSyncStatusSucceeded: {repoSyncStatusRunning},
+	repoSyncStatusFailed:    {repoSyncStatusRunning},
+	repoSyncStatusBlocked:   {repoSyncStatusPending},
+}
+
+type errorInvalidTransition struct {
+	error
+}
+
+// IsInvalidTransition checks whether the error is caused by changing the
+// status of lock to the one which is not allowed.
+func IsInvalidTransition(err error) bool {
+	_, ok := err.(errorInvalidTransition)
+
+	return ok
+}
+
 // RepoSyncStatus
 type RepoSyncStatus interface {
 	RepoSyncStatus() string
-	IsDone() bool
+	IsRunning() bool
+	IsBlocked() bool
+	CanTransitTo(RepoSyncStatus) bool
 }
 
 func NewRepoSyncStatus(s string) (RepoSyncStatus, error) {
@@ -23,7 +65,11 @@ func NewRepoSyncStatus(s string) (RepoSyncStatus, error) {
 		return nil, nil
 	}
 
-	if s != repoSyncStatusDone && s != repoSyncStatusRunning {
+	if s == repoSyncStatusDone {
+		return RepoSyncStatusSucceeded, nil
+	}
+
+	if _, ok := repoSyncTransitions[s]; !ok {
 		return nil, errors.New("invalid repo sync status")
 	}
 
@@ -36,15 +82,157 @@ func (s repoSyncStatus) RepoSyncStatus() string {
 	return string(s)
 }
 
-func (s repoSyncStatus) IsDone() bool {
-	return string(s) == repoSyncStatusDone
+func (s repoSyncStatus) IsRunning() bool {
+	return string(s) == repoSyncStatusRunning
+}
+
+func (s repoSyncStatus) IsBlocked() bool {
+	return string(s) == repoSyncStatusBlocked
+}
+
+func (s repoSyncStatus) CanTransitTo(to RepoSyncStatus) bool {
+	for _, v := range repoSyncTransitions[string(s)] {
+		if v == to.RepoSyncStatus() {
+			return true
+		}
+	}
+
+	return false
 }
 
 type RepoSyncLock struct {
 	Id         string
 	Owner      Account
 	RepoId     string
+	Ref        string
 	Status     RepoSyncStatus
 	Version    int
 	LastCommit string
+
+	// RepoType is the type of repo, and it is nil if unknown.
+	RepoType ResourceType
+
+	// Failures is the number of consecutive failed syncs, and LastError
+	// is the error of the last one.
+	Failures  int
+	LastError string
+
+	// Holder is the id of the instance which is running the sync.
+	Holder string
+	// Expiry is the unix time when the lease of running sync expires.
+	Expiry int64
+	// Fence is the fencing token of running sync which increases on every
+	// acquisition. It is 0 if the lock doesn't support it.
+	Fence int64
+}
+
+// IsExpired checks whether the running sync has not renewed its lease in time,
+// which means the holder is dead and the lock can be taken over.
+func (r *RepoSyncLock) IsExpired(now int64) bool {
+	return r.Expiry <= now
+}
+
+// IsRunning checks whether the repo is being synced, no matter whether
+// the lease expires.
+func (r *RepoSyncLock) IsRunning() bool {
+	return r.Status != nil && r.Status.IsRunning()
+}
+
+// IsBlocked checks whether the repo is quarantined after too many failures.
+func (r *RepoSyncLock) IsBlocked() bool {
+	return r.Status != nil && r.Status.IsBlocked()
+}
+
+// Start transits to running which is held by holder until expiry.
+func (r *RepoSyncLock) Start(holder string, expiry int64) error {
+	if err := r.transit(RepoSyncStatusRunning); err != nil {
+		return err
+	}
+
+	r.Holder = holder
+	r.Expiry = expiry
+
+	return nil
+}
+
+// Succeed finishes the running sync which has synced to lastCommit.
+func (r *RepoSyncLock) Succeed(lastCommit string) error {
+	if err := r.finish(RepoSyncStatusSucceeded); err != nil {
+		return err
+	}
+
+	r.LastCommit = lastCommit
+	r.Failures = 0
+	r.LastError = ""
+
+	return nil
+}
+
+// Fail finishes the running sync with the error. It is blocked if it
+// has failed maxFailures times consecutively, and never if maxFailures is 0.
+func (r *RepoSyncLock) Fail(lastError string, maxFailures int) error {
+	status := RepoSyncStatusFailed
+	if maxFailures > 0 && r.Failures+1 >= maxFailures {
+		status = RepoSyncStatusBlocked
+	}
+
+	if err := r.finish(status); err != nil {
+		return err
+	}
+
+	r.Failures++
+	r.LastError = lastError
+
+	return nil
+}
+
+// Abort finishes the running sync without the result, so it is pending.
+func (r *RepoSyncLock) Abort() error {
+	return r.finish(RepoSyncStatusPending)
+}
+
+// Unblock makes the blocked repo can be synced again.
+// The running one can also turn to pending, so it is checked first.
+func (r *RepoSyncLock) Unblock() error {
+	if !r.IsBlocked() {
+		return errorInvalidTransition{errors.New("the repo sync is not blocked")}
+	}
+
+	if err := r.transit(RepoSyncStatusPending); err != nil {
+		return err
+	}
+
+	r.Failures = 0
+
+	return nil
+}
+
+func (r *RepoSyncLock) finish(status RepoSyncStatus) error {
+	if err := r.transit(status); err != nil {
+		return err
+	}
+
+	r.Holder = ""
+	r.Expiry = 0
+
+	return nil
+}
+
+// transit changes the status if it is allowed. The new lock is pending.
+func (r *RepoSyncLock) transit(to RepoSyncStatus) error {
+	from := r.Status
+	if from == nil {
+		from = RepoSyncStatusPending
+	}
+
+	if !from.CanTransitTo(to) {
+		return errorInvalidTransition{fmt.Errorf(
+			"can't transit the repo sync status from %s to %s",
+			from.RepoSyncStatus(), to.RepoSyncStatus(),
+		)}
+	}
+
+	r.Status = to
+
+	return nil
 }
@@ -0,0 +1,147 @@
+package domain
+
+import "testing"
+
+func newRunningLock(t *testing.T) RepoSyncLock {
+	r := RepoSyncLock{}
+	if err := r.Start("a", 100); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	return r
+}
+
+func TestSucceed(t *testing.T) {
+	r := newRunningLock(t)
+	r.Failures = 2
+	r.LastError = "err"
+
+	if err := r.Succeed("commit"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if r.Status != RepoSyncStatusSucceeded || r.LastCommit != "commit" {
+		t.Fatalf("unexpected lock: %+v", r)
+	}
+
+	if r.Failures != 0 || r.LastError != "" || r.Holder != "" || r.Expiry != 0 {
+		t.Fatalf("the failures or holder is not cleared: %+v", r)
+	}
+
+	if err := r.Succeed("commit"); !IsInvalidTransition(err) {
+		t.Fatalf("succeed the finished sync: err = %v", err)
+	}
+}
+
+func TestFail(t *testing.T) {
+	cases := []struct {
+		name        string
+		maxFailures int
+		failures    int
+		want        RepoSyncStatus
+	}{
+		{"first failure", 3, 0, RepoSyncStatusFailed},
+		{"below max failures", 3, 1, RepoSyncStatusFailed},
+		{"reach max failures", 3, 2, RepoSyncStatusBlocked},
+		{"block at once", 1, 0, RepoSyncStatusBlocked},
+		{"never block", 0, 100, RepoSyncStatusFailed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newRunningLock(t)
+			r.Failures = c.failures
+
+			if err := r.Fail("err", c.maxFailures); err != nil {
+				t.Fatalf("fail: %v", err)
+			}
+
+			if r.Status != c.want {
+				t.Fatalf("status = %s, want %s", r.Status.RepoSyncStatus(), c.want.RepoSyncStatus())
+			}
+
+			if r.Failures != c.failures+1 || r.LastError != "err" {
+				t.Fatalf("failures = %d, last error = %s", r.Failures, r.LastError)
+			}
+
+			if r.Holder != "" || r.Expiry != 0 {
+				t.Fatalf("the holder is not cleared: %+v", r)
+			}
+		})
+	}
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	r := RepoSyncLock{}
+
+	for i := 1; i <= 3; i++ {
+		if err := r.Start("a", 100); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+
+		if err := r.Fail("err", 3); err != nil {
+			t.Fatalf("fail %d: %v", i, err)
+		}
+
+		if r.Failures != i {
+			t.Fatalf("failures = %d, want %d", r.Failures, i)
+		}
+	}
+
+	if !r.IsBlocked() {
+		t.Fatalf("status = %s, want blocked", r.Status.RepoSyncStatus())
+	}
+
+	if err := r.Start("a", 100); !IsInvalidTransition(err) {
+		t.Fatalf("start the blocked sync: err = %v", err)
+	}
+
+	if err := r.Unblock(); err != nil {
+		t.Fatalf("unblock: %v", err)
+	}
+
+	if r.Status != RepoSyncStatusPending || r.Failures != 0 {
+		t.Fatalf("unexpected unblocked lock: %+v", r)
+	}
+
+	if err := r.Start("a", 100); err != nil {
+		t.Fatalf("start the unblocked sync: %v", err)
+	}
+
+	if err := r.Fail("err", 3); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+
+	if r.IsBlocked() || r.Failures != 1 {
+		t.Fatalf("the failures before unblocking are counted: %+v", r)
+	}
+}
+
+func TestUnblockNotBlocked(t *testing.T) {
+	r := newRunningLock(t)
+
+	if err := r.Unblock(); !IsInvalidTransition(err) {
+		t.Fatalf("unblock the running sync: err = %v", err)
+	}
+
+	if err := r.Succeed("commit"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if err := r.Unblock(); !IsInvalidTransition(err) {
+		t.Fatalf("unblock the succeeded sync: err = %v", err)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	r := newRunningLock(t)
+	r.Failures = 1
+
+	if err := r.Abort(); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+
+	if r.Status != RepoSyncStatusPending || r.Failures != 1 || r.Holder != "" {
+		t.Fatalf("unexpected aborted lock: %+v", r)
+	}
+}
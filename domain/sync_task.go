@@ -0,0 +1,74 @@
+package domain
+
+import "errors"
+
+const (
+	syncTaskStatusPending = "pending"
+	syncTaskStatusDead    = "dead"
+)
+
+var (
+	SyncTaskStatusPending = syncTaskStatus(syncTaskStatusPending)
+	SyncTaskStatusDead    = syncTaskStatus(syncTaskStatusDead)
+)
+
+// SyncTaskStatus
+type SyncTaskStatus interface {
+	SyncTaskStatus() string
+	IsDead() bool
+}
+
+func NewSyncTaskStatus(s string) (SyncTaskStatus, error) {
+	if s != syncTaskStatusPending && s != syncTaskStatusDead {
+		return nil, errors.New("invalid sync task status")
+	}
+
+	return syncTaskStatus(s), nil
+}
+
+type syncTaskStatus string
+
+func (s syncTaskStatus) SyncTaskStatus() string {
+	return string(s)
+}
+
+func (s syncTaskStatus) IsDead() bool {
+	return string(s) == syncTaskStatusDead
+}
+
+func IsValidSyncTaskAction(s string) bool {
+	switch s {
+	case SyncTaskActionSync, SyncTaskActionDeleteRef,
+		SyncTaskActionDeleteRepo, SyncTaskActionMoveRepo:
+		return true
+	}
+
+	return false
+}
+
+const (
+	// SyncTaskActionSync is the action of the task saved by the versions
+	// before the lifecycle changes are retried, so it is empty.
+	SyncTaskActionSync       = ""
+	SyncTaskActionDeleteRef  = "delete_ref"
+	SyncTaskActionDeleteRepo = "delete_repo"
+	SyncTaskActionMoveRepo   = "move_repo"
+)
+
+// SyncTask is a failed sync of repo which will be retried at NextRetry.
+// It will not be retried any more when it is dead.
+// It may also be a change of repo, such as deleting the repo, which is
+// retried in the same way. The Owner of MoveRepo is the new owner.
+type SyncTask struct {
+	Id        string
+	Owner     Account
+	RepoId    string
+	RepoName  string
+	Ref       string
+	Action    string
+	Status    SyncTaskStatus
+	Attempts  int
+	LastError string
+	NextRetry int64
+	Version   int
+}
@@ -0,0 +1,23 @@
+package synchistory
+
+import (
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+)
+
+// ListOption is the option to list histories. The empty fields are not
+// used to filter. The histories are sorted by start time in descending order.
+type ListOption struct {
+	Owner  string
+	RepoId string
+	// Ref is used to filter if it is not nil, and the empty one is the
+	// default branch.
+	Ref    *string
+	Offset int
+	Limit  int
+}
+
+type SyncHistory interface {
+	Add(*domain.SyncHistory) error
+	// List returns the histories and the total number of matched ones.
+	List(*ListOption) ([]domain.SyncHistory, int, error)
+}
@@ -18,7 +18,37 @@ func IsRepoSyncLockNotExist(err error) bool {
 	return ok
 }
 
+// errorConcurrentUpdating means the lock has been changed by the others,
+// like the running sync has been taken over after its lease expired.
+type errorConcurrentUpdating struct {
+	error
+}
+
+func NewErrorConcurrentUpdating(err error) errorConcurrentUpdating {
+	return errorConcurrentUpdating{err}
+}
+
+func IsConcurrentUpdating(err error) bool {
+	_, ok := err.(errorConcurrentUpdating)
+
+	return ok
+}
+
+// ListOption is the option to list locks. The empty fields are not used to filter,
+// and all the locks are listed if Limit is 0.
+type ListOption struct {
+	Owner  string
+	Status string
+	Offset int
+	Limit  int
+}
+
 type RepoSyncLock interface {
-	Find(owner domain.Account, repoId string) (domain.RepoSyncLock, error)
+	// Find returns the lock of ref which is empty for the default branch.
+	Find(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error)
+	// FindByRepo returns the locks of all the refs of repo.
+	FindByRepo(repoId string) ([]domain.RepoSyncLock, error)
+	List(*ListOption) ([]domain.RepoSyncLock, error)
 	Save(*domain.RepoSyncLock) (domain.RepoSyncLock, error)
+	Remove(*domain.RepoSyncLock) error
 }
@@ -0,0 +1,29 @@
+package synctask
+
+import (
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+)
+
+type errorTaskNotExists struct {
+	error
+}
+
+func NewErrorTaskNotExists(err error) errorTaskNotExists {
+	return errorTaskNotExists{err}
+}
+
+func IsSyncTaskNotExist(err error) bool {
+	_, ok := err.(errorTaskNotExists)
+
+	return ok
+}
+
+type SyncTask interface {
+	Find(owner domain.Account, repoId, ref string) (domain.SyncTask, error)
+	// FindDue returns the pending tasks which should be retried before now.
+	FindDue(now int64, limit int) ([]domain.SyncTask, error)
+	Save(*domain.SyncTask) (domain.SyncTask, error)
+	Remove(*domain.SyncTask) error
+	// RemoveByRepo removes all the tasks of repo.
+	RemoveByRepo(repoId string) error
+}
@@ -3,12 +3,17 @@ module github.com/opensourceways/robot-gitlab-sync-repo
 go 1.16
 
 require (
+	github.com/glebarez/sqlite v1.8.0
+	github.com/go-redis/redis/v8 v8.8.0
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/hashicorp/go-retryablehttp v0.7.1
 	github.com/huaweicloud/huaweicloud-sdk-go-obs v3.21.12+incompatible
+	github.com/minio/minio-go/v7 v7.0.50
 	github.com/opensourceways/community-robot-lib v0.0.0-20220913083753-f2348220c773
+	github.com/prometheus/client_golang v1.12.2
 	github.com/sirupsen/logrus v1.9.0
 	github.com/xanzy/go-gitlab v0.73.1
 	gorm.io/driver/mysql v1.4.0
-	gorm.io/gorm v1.24.0
+	gorm.io/driver/postgres v1.4.5
+	gorm.io/gorm v1.24.6
 )
@@ -0,0 +1,77 @@
+package limitimpl
+
+import (
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+)
+
+// NewLimitedOBS returns the obs.OBS which allows at most n calls to s at
+// the same time. A call of UploadFile is counted as one, though it may send
+// several parts at the same time.
+func NewLimitedOBS(s dobs.OBS, n int) dobs.OBS {
+	return &limitedOBS{
+		s:   s,
+		sem: make(chan struct{}, n),
+	}
+}
+
+type limitedOBS struct {
+	s   dobs.OBS
+	sem chan struct{}
+}
+
+func (l *limitedOBS) acquire() {
+	l.sem <- struct{}{}
+}
+
+func (l *limitedOBS) release() {
+	<-l.sem
+}
+
+func (l *limitedOBS) SaveObject(path, content string) error {
+	l.acquire()
+	defer l.release()
+
+	return l.s.SaveObject(path, content)
+}
+
+func (l *limitedOBS) UploadFile(path, file string, cp dobs.Checkpoint, limiter dobs.Limiter) error {
+	l.acquire()
+	defer l.release()
+
+	return l.s.UploadFile(path, file, cp, limiter)
+}
+
+func (l *limitedOBS) GetObject(path string) ([]byte, error) {
+	l.acquire()
+	defer l.release()
+
+	return l.s.GetObject(path)
+}
+
+func (l *limitedOBS) GetObjectMeta(path string) (*dobs.ObjectMeta, error) {
+	l.acquire()
+	defer l.release()
+
+	return l.s.GetObjectMeta(path)
+}
+
+func (l *limitedOBS) CopyObject(dst, src string) error {
+	l.acquire()
+	defer l.release()
+
+	return l.s.CopyObject(dst, src)
+}
+
+func (l *limitedOBS) DeleteObject(path string) error {
+	l.acquire()
+	defer l.release()
+
+	return l.s.DeleteObject(path)
+}
+
+func (l *limitedOBS) ListObjects(prefix string) ([]dobs.ObjectMeta, error) {
+	l.acquire()
+	defer l.release()
+
+	return l.s.ListObjects(prefix)
+}
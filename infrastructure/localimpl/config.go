@@ -0,0 +1,19 @@
+package localimpl
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+type Config struct {
+	// Root is the directory where the objects are saved.
+	Root string `json:"root" required:"true"`
+}
+
+func (c *Config) Validate() error {
+	if !filepath.IsAbs(c.Root) {
+		return errors.New("root must be an absolute path")
+	}
+
+	return nil
+}
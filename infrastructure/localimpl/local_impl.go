@@ -0,0 +1,388 @@
+package localimpl
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+const (
+	// metaDir is the directory under root which saves the md5 of objects
+	// and the temporary files. It is not an object path.
+	metaDir = ".meta"
+	md5Dir  = "md5"
+	tmpDir  = "tmp"
+
+	// writeRetries is the times to write an object whose directory is
+	// removed by the concurrent deletion.
+	writeRetries = 3
+)
+
+// NewLocal returns the obs.OBS which saves the objects as files under
+// the root directory. The object path is the relative path of file, so
+// the path of an object can't be the prefix directory of the others,
+// such as a and a/b.
+func NewLocal(cfg *Config) (dobs.OBS, error) {
+	s := &localImpl{root: cfg.Root}
+
+	if err := os.MkdirAll(s.metaPath(tmpDir), 0755); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+type localImpl struct {
+	root string
+}
+
+// filePath returns the file of object, and it can't be out of root.
+func (s *localImpl) filePath(path string) (string, error) {
+	v := filepath.Clean("/" + path)
+	if v == "/" {
+		return "", errors.New("invalid object path")
+	}
+
+	if v == "/"+metaDir || strings.HasPrefix(v, "/"+metaDir+"/") {
+		return "", errors.New("object path can't be under " + metaDir)
+	}
+
+	return filepath.Join(s.root, v), nil
+}
+
+func (s *localImpl) metaPath(elem ...string) string {
+	return filepath.Join(append([]string{s.root, metaDir}, elem...)...)
+}
+
+// md5Path returns the sidecar file which saves the md5 of object file p.
+func (s *localImpl) md5Path(p string) string {
+	return s.metaPath(md5Dir, strings.TrimPrefix(p, s.root))
+}
+
+func (s *localImpl) SaveObject(path, content string) error {
+	return s.writeFile(path, strings.NewReader(content))
+}
+
+// UploadFile copies the file, and the checkpoint is not needed.
+func (s *localImpl) UploadFile(path, file string, cp dobs.Checkpoint, limiter dobs.Limiter) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return s.writeFile(path, utils.NewLimitedReader(f, limiter))
+}
+
+// writeFile writes to a temporary file first so that the object is
+// either the old one or the new one. The md5 is computed during writing.
+func (s *localImpl) writeFile(path string, r io.Reader) error {
+	p, err := s.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.metaPath(tmpDir), "obj-")
+	if err != nil {
+		return err
+	}
+
+	h := md5.New()
+
+	_, err = io.Copy(f, io.TeeReader(r, h))
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+
+	if err == nil {
+		err = s.rename(path, f.Name(), p)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	s.saveMD5(p, fmt.Sprintf("%x", h.Sum(nil)))
+
+	return nil
+}
+
+// rename moves the temporary file to p. The directory of p may be removed
+// by the deletion of the last object in it at the same time, so it is
+// created again.
+func (s *localImpl) rename(path, tmp, p string) (err error) {
+	for i := 0; i < writeRetries; i++ {
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return s.checkConflict(path, p, err)
+		}
+
+		if err = os.Rename(tmp, p); err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return s.checkConflict(path, p, err)
+	}
+
+	return nil
+}
+
+// checkConflict returns the clear error if the object is conflict with
+// the others, because they are the files and directories at the same time.
+func (s *localImpl) checkConflict(path, p string, err error) error {
+	if info, err1 := os.Stat(p); err1 == nil && info.IsDir() {
+		return fmt.Errorf(
+			"can't save object %s which is the prefix directory of other objects", path,
+		)
+	}
+
+	for dir := filepath.Dir(p); dir != s.root; dir = filepath.Dir(dir) {
+		if info, err1 := os.Stat(dir); err1 == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(s.root, dir)
+
+			return fmt.Errorf(
+				"can't save object %s under object %s", path, filepath.ToSlash(rel),
+			)
+		}
+	}
+
+	return err
+}
+
+// saveMD5 saves the md5 with the size and modification time of file, so
+// that it is computed again if the file is changed by others. It is fine
+// to fail, and the md5 will be computed when it is needed.
+func (s *localImpl) saveMD5(p, v string) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return
+	}
+
+	sidecar := s.md5Path(p)
+
+	if err = os.MkdirAll(filepath.Dir(sidecar), 0755); err == nil {
+		err = ioutil.WriteFile(sidecar, []byte(md5Record(info, v)), 0644)
+	}
+
+	if err != nil {
+		logrus.Warnf("save md5 of %s failed, err:%s", p, err.Error())
+	}
+}
+
+// fileMD5 returns the md5 saved in the sidecar if the file is not changed
+// after it is saved, otherwise it computes the md5 by reading the file.
+func (s *localImpl) fileMD5(p string, info os.FileInfo) (string, error) {
+	if v, err := ioutil.ReadFile(s.md5Path(p)); err == nil {
+		if items := strings.SplitN(string(v), " ", 2); len(items) == 2 &&
+			md5Record(info, items[0]) == string(v) {
+			return items[0], nil
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	v := fmt.Sprintf("%x", h.Sum(nil))
+
+	s.saveMD5(p, v)
+
+	return v, nil
+}
+
+func md5Record(info os.FileInfo, v string) string {
+	return fmt.Sprintf("%s %d %d", v, info.Size(), info.ModTime().UnixNano())
+}
+
+// isNotExist also checks the error of reading an object under the file of
+// other object.
+func isNotExist(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
+
+func (s *localImpl) GetObject(path string) ([]byte, error) {
+	p, err := s.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return nil, nil
+	}
+
+	v, err := ioutil.ReadFile(p)
+	if err != nil && isNotExist(err) {
+		return nil, nil
+	}
+
+	return v, err
+}
+
+func (s *localImpl) GetObjectMeta(path string) (*dobs.ObjectMeta, error) {
+	p, err := s.filePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		if isNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	v, err := s.fileMD5(p, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dobs.ObjectMeta{
+		Path: path,
+		Size: info.Size(),
+		ETag: v,
+	}, nil
+}
+
+func (s *localImpl) CopyObject(dst, src string) error {
+	logrus.Debugf("copy object %s to %s", src, dst)
+
+	p, err := s.filePath(src)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return s.writeFile(dst, f)
+}
+
+// DeleteObject removes the file of object and the directories which
+// become empty.
+func (s *localImpl) DeleteObject(path string) error {
+	logrus.Debugf("delete object %s", path)
+
+	p, err := s.filePath(path)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return nil
+	}
+
+	if err := os.Remove(p); err != nil && !isNotExist(err) {
+		return err
+	}
+
+	sidecar := s.md5Path(p)
+	if err := os.Remove(sidecar); err != nil && !isNotExist(err) {
+		return err
+	}
+
+	removeEmptyDirs(filepath.Dir(p), s.root)
+	removeEmptyDirs(filepath.Dir(sidecar), s.metaPath(md5Dir))
+
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents until root or the one which
+// is not empty.
+func removeEmptyDirs(dir, root string) {
+	for ; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func (s *localImpl) ListObjects(prefix string) ([]dobs.ObjectMeta, error) {
+	// the prefix may end with a part of file name.
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(s.root, filepath.Clean("/"+prefix[:i]))
+	}
+
+	meta := s.metaPath()
+	if dir == meta || strings.HasPrefix(dir, meta+"/") {
+		return nil, nil
+	}
+
+	var r []dobs.ObjectMeta
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if isNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if p == meta {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.ToSlash(rel)
+		if !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+
+		v, err := s.fileMD5(p, info)
+		if err != nil {
+			return err
+		}
+
+		r = append(r, dobs.ObjectMeta{
+			Path: path,
+			Size: info.Size(),
+			ETag: v,
+		})
+
+		return nil
+	})
+
+	return r, err
+}
@@ -0,0 +1,181 @@
+package localimpl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+func newTestLocal(t *testing.T) (*localImpl, string) {
+	root := filepath.Join(t.TempDir(), "root")
+
+	s, err := NewLocal(&Config{Root: root})
+	if err != nil {
+		t.Fatalf("new local: %v", err)
+	}
+
+	return s.(*localImpl), root
+}
+
+func listPaths(t *testing.T, s dobs.OBS, prefix string) []string {
+	v, err := s.ListObjects(prefix)
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+
+	var r []string
+	for i := range v {
+		r = append(r, v[i].Path)
+	}
+
+	return r
+}
+
+func TestObjects(t *testing.T) {
+	s, _ := newTestLocal(t)
+
+	for _, p := range []string{"repo/a", "repo/dir/b", "repo2/c"} {
+		if err := s.SaveObject(p, p); err != nil {
+			t.Fatalf("save %s: %v", p, err)
+		}
+	}
+
+	if err := s.CopyObject("repo/dir/d", "repo/a"); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	if v, err := s.GetObject("repo/dir/d"); err != nil || string(v) != "repo/a" {
+		t.Fatalf("get copied object: %q, %v", v, err)
+	}
+
+	m, err := s.GetObjectMeta("repo/dir/b")
+	if err != nil || m == nil || m.Size != 10 || m.ETag != utils.GenMD5([]byte("repo/dir/b")) {
+		t.Fatalf("get meta: %+v, %v", m, err)
+	}
+
+	for _, p := range []string{"repo/x", "repo/dir", "repo/a/x"} {
+		if m, err := s.GetObjectMeta(p); err != nil || m != nil {
+			t.Fatalf("get meta of missing %s: %+v, %v", p, m, err)
+		}
+
+		if v, err := s.GetObject(p); err != nil || v != nil {
+			t.Fatalf("get missing %s: %q, %v", p, v, err)
+		}
+	}
+
+	cases := []struct {
+		prefix string
+		want   []string
+	}{
+		{"repo/", []string{"repo/a", "repo/dir/b", "repo/dir/d"}},
+		{"repo", []string{"repo/a", "repo/dir/b", "repo/dir/d", "repo2/c"}},
+		{"repo/dir/", []string{"repo/dir/b", "repo/dir/d"}},
+		{"repo/a/", nil},
+		{"none/", nil},
+		{"", []string{"repo/a", "repo/dir/b", "repo/dir/d", "repo2/c"}},
+	}
+
+	for _, c := range cases {
+		if v := listPaths(t, s, c.prefix); !reflect.DeepEqual(v, c.want) {
+			t.Errorf("list %q = %v, want %v", c.prefix, v, c.want)
+		}
+	}
+}
+
+func TestDeleteObject(t *testing.T) {
+	s, root := newTestLocal(t)
+
+	for _, p := range []string{"repo/a/b/c", "repo/d"} {
+		if err := s.SaveObject(p, p); err != nil {
+			t.Fatalf("save %s: %v", p, err)
+		}
+	}
+
+	if err := s.DeleteObject("repo/a/b/c"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// the directories which become empty are removed.
+	for _, p := range []string{"repo/a", ".meta/md5/repo/a"} {
+		if _, err := os.Stat(filepath.Join(root, p)); !os.IsNotExist(err) {
+			t.Errorf("%s is not removed: %v", p, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "repo")); err != nil {
+		t.Errorf("repo is removed: %v", err)
+	}
+
+	// it is fine to delete the missing object.
+	if err := s.DeleteObject("repo/a/b/c"); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+
+	// the object can be saved again.
+	if err := s.SaveObject("repo/a/b/c", "v"); err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+}
+
+func TestConflictObjects(t *testing.T) {
+	s, _ := newTestLocal(t)
+
+	if err := s.SaveObject("a/b", "v"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	err := s.SaveObject("a", "v")
+	if err == nil || !strings.Contains(err.Error(), "prefix directory of other objects") {
+		t.Fatalf("save the prefix of other object: %v", err)
+	}
+
+	err = s.SaveObject("a/b/c/d", "v")
+	if err == nil || !strings.Contains(err.Error(), "under object a/b") {
+		t.Fatalf("save under other object: %v", err)
+	}
+
+	if err := s.SaveObject(".meta/x", "v"); err == nil {
+		t.Fatal("save the object under the meta directory")
+	}
+}
+
+func TestMD5Sidecar(t *testing.T) {
+	s, root := newTestLocal(t)
+
+	if err := s.SaveObject("repo/a", "v1"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// the saved md5 is used without reading the file.
+	p := filepath.Join(root, "repo/a")
+	info, _ := os.Stat(p)
+	fake := md5Record(info, "saved")
+	if err := ioutil.WriteFile(s.md5Path(p), []byte(fake), 0644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+
+	if m, _ := s.GetObjectMeta("repo/a"); m == nil || m.ETag != "saved" {
+		t.Fatalf("the saved md5 is not used: %+v", m)
+	}
+
+	// the file is changed by others.
+	if err := ioutil.WriteFile(p, []byte("v2"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(p, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	v, err := s.ListObjects("repo/")
+	if err != nil || len(v) != 1 || v[0].ETag != utils.GenMD5([]byte("v2")) {
+		t.Fatalf("the md5 is not computed again: %+v, %v", v, err)
+	}
+}
@@ -1,46 +0,0 @@
-package mysql
-
-import (
-	"time"
-
-	_ "github.com/go-sql-driver/mysql"
-	gormmysql "gorm.io/driver/mysql"
-	"gorm.io/gorm"
-)
-
-var cli *mysqlService
-
-func Init(cfg *Config) error {
-	config := gormmysql.Config{
-		DSN:                       cfg.Conn,
-		DontSupportRenameIndex:    true,
-		DontSupportRenameColumn:   true,
-		SkipInitializeWithVersion: false,
-	}
-
-	db, err := gorm.Open(gormmysql.New(config), &gorm.Config{})
-	if err != nil {
-		return err
-	}
-
-	sqlDB, err := db.DB()
-	if err != nil {
-		return err
-	}
-
-	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
-	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
-
-	cli = &mysqlService{
-		db: db,
-	}
-
-	tableName = cfg.TableName
-
-	return nil
-}
-
-type mysqlService struct {
-	db *gorm.DB
-}
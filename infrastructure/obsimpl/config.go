@@ -6,7 +6,9 @@ import (
 )
 
 type Config struct {
-	OBSUtilPath string `json:"obsutil_path"  required:"true"`
+	// OBSUtilPath is required by the shell engine of sync, which uses
+	// the obsutil configured with the credentials below and the Bucket.
+	OBSUtilPath string `json:"obsutil_path"`
 	AccessKey   string `json:"access_key"    required:"true"`
 	SecretKey   string `json:"secret_key"    required:"true"`
 	Endpoint    string `json:"endpoint"      required:"true"`
@@ -14,7 +16,7 @@ type Config struct {
 }
 
 func (c *Config) Validate() error {
-	if !filepath.IsAbs(c.OBSUtilPath) {
+	if c.OBSUtilPath != "" && !filepath.IsAbs(c.OBSUtilPath) {
 		return errors.New("obsutil_path must be an absolute path")
 	}
 
@@ -18,25 +18,28 @@ func NewOBS(cfg *Config) (dobs.OBS, error) {
 		return nil, fmt.Errorf("new obs client failed, err:%s", err.Error())
 	}
 
-	_, err, _ = utils.RunCmd(
-		cfg.OBSUtilPath, "config",
-		"-i="+cfg.AccessKey, "-k="+cfg.SecretKey, "-e="+cfg.Endpoint,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("obsutil config failed, err:%s", err.Error())
+	// obsutil is only needed by the shell engine of sync
+	if cfg.OBSUtilPath != "" {
+		utils.AddSecret(cfg.SecretKey)
+
+		_, err, _ = utils.RunCmd(
+			cfg.OBSUtilPath, "config",
+			"-i="+cfg.AccessKey, "-k="+cfg.SecretKey, "-e="+cfg.Endpoint,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("obsutil config failed, err:%s", err.Error())
+		}
 	}
 
 	return &obsImpl{
 		obsClient: cli,
 		bucket:    cfg.Bucket,
-		obsutil:   cfg.OBSUtilPath,
 	}, nil
 }
 
 type obsImpl struct {
 	obsClient *obs.ObsClient
 	bucket    string
-	obsutil   string
 }
 
 func (s *obsImpl) SaveObject(path, content string) error {
@@ -44,8 +47,7 @@ func (s *obsImpl) SaveObject(path, content string) error {
 	input.Bucket = s.bucket
 	input.Key = path
 	input.Body = strings.NewReader(content)
-	// The md5 generated by utils.GenMD5 is not same by md5sum
-	//input.ContentMD5 = utils.GenMD5([]byte(content))
+	input.ContentMD5 = utils.GenMD5Base64([]byte(content))
 
 	_, err := s.obsClient.PutObject(input)
 
@@ -66,6 +68,53 @@ func (s *obsImpl) CopyObject(dst, src string) error {
 	return err
 }
 
+func (s *obsImpl) DeleteObject(path string) error {
+	input := &obs.DeleteObjectInput{}
+	input.Bucket = s.bucket
+	input.Key = path
+
+	logrus.Debugf("delete object %s", path)
+
+	_, err := s.obsClient.DeleteObject(input)
+
+	return err
+}
+
+func (s *obsImpl) ListObjects(prefix string) ([]dobs.ObjectMeta, error) {
+	var r []dobs.ObjectMeta
+
+	input := &obs.ListObjectsInput{}
+	input.Bucket = s.bucket
+	input.Prefix = prefix
+	input.MaxKeys = 1000
+
+	for {
+		output, err := s.obsClient.ListObjects(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range output.Contents {
+			item := &output.Contents[i]
+
+			r = append(r, dobs.ObjectMeta{
+				Path: item.Key,
+				Size: item.Size,
+				ETag: strings.Trim(item.ETag, "\""),
+			})
+		}
+
+		if !output.IsTruncated || len(output.Contents) == 0 {
+			return r, nil
+		}
+
+		input.Marker = output.NextMarker
+		if input.Marker == "" {
+			input.Marker = output.Contents[len(output.Contents)-1].Key
+		}
+	}
+}
+
 func (s *obsImpl) GetObject(path string) ([]byte, error) {
 	input := &obs.GetObjectInput{}
 	input.Bucket = s.bucket
@@ -88,10 +137,24 @@ func (s *obsImpl) GetObject(path string) ([]byte, error) {
 	return v, err
 }
 
-func (s *obsImpl) OBSUtilPath() string {
-	return s.obsutil
-}
+func (s *obsImpl) GetObjectMeta(path string) (*dobs.ObjectMeta, error) {
+	input := &obs.GetObjectMetadataInput{}
+	input.Bucket = s.bucket
+	input.Key = path
+
+	output, err := s.obsClient.GetObjectMetadata(input)
+	if err != nil {
+		v, ok := err.(obs.ObsError)
+		if ok && v.BaseModel.StatusCode == 404 {
+			return nil, nil
+		}
 
-func (s *obsImpl) OBSBucket() string {
-	return s.bucket
+		return nil, err
+	}
+
+	return &dobs.ObjectMeta{
+		Path: path,
+		Size: output.ContentLength,
+		ETag: strings.Trim(output.ETag, "\""),
+	}, nil
 }
@@ -0,0 +1,224 @@
+package obsimpl
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/sirupsen/logrus"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+const (
+	uploadPartSize = 16 << 20
+
+	// uploadTaskNum is the number of parts uploaded concurrently.
+	uploadTaskNum = 4
+)
+
+// uploadCheckpoint is the multipart upload of the content identified by
+// Version. It is valid no matter where the file is, so that the upload
+// can be resumed by the later sync which checks out the file again.
+type uploadCheckpoint struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Size     int64  `json:"size"`
+	UploadId string `json:"upload_id"`
+}
+
+func (cp *uploadCheckpoint) isValid(path, version string, size int64) bool {
+	return cp.UploadId != "" && version != "" && cp.Path == path &&
+		cp.Version == version && cp.Size == size
+}
+
+func (cp *uploadCheckpoint) save(checkpoint string) error {
+	v, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(checkpoint, v, 0600)
+}
+
+func loadCheckpoint(checkpoint string) (cp uploadCheckpoint) {
+	if v, err := ioutil.ReadFile(checkpoint); err == nil {
+		// the broken checkpoint, like the one saved by the sdk before,
+		// is same as no checkpoint.
+		_ = json.Unmarshal(v, &cp)
+	}
+
+	return
+}
+
+// UploadFile uploads the file by multipart, and the uploaded parts are
+// skipped when resuming from the checkpoint. The parts are read through
+// limiter, so only the bytes sent are charged to it.
+func (s *obsImpl) UploadFile(path, file string, checkpoint dobs.Checkpoint, limiter dobs.Limiter) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("upload file %s to %s", file, path)
+
+	cp := loadCheckpoint(checkpoint.File)
+
+	var parts map[int]obs.Part
+	if cp.isValid(path, checkpoint.Version, info.Size()) {
+		// the upload may have been aborted or expired.
+		if parts, err = s.listParts(&cp); err != nil {
+			logrus.Warnf("resume upload of %s failed, err:%s", path, err.Error())
+		}
+	}
+
+	if parts == nil {
+		if cp.UploadId != "" {
+			s.abortUpload(&cp)
+		}
+
+		if cp, err = s.newUpload(path, checkpoint, info.Size()); err != nil {
+			return err
+		}
+
+		parts = map[int]obs.Part{}
+	}
+
+	completed, err := s.uploadParts(&cp, file, parts, limiter)
+	if err != nil {
+		return err
+	}
+
+	input := &obs.CompleteMultipartUploadInput{}
+	input.Bucket = s.bucket
+	input.Key = path
+	input.UploadId = cp.UploadId
+	input.Parts = completed
+
+	if _, err = s.obsClient.CompleteMultipartUpload(input); err != nil {
+		return err
+	}
+
+	if err = os.Remove(checkpoint.File); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("remove checkpoint %s failed, err:%s", checkpoint.File, err.Error())
+	}
+
+	return nil
+}
+
+func (s *obsImpl) newUpload(
+	path string, checkpoint dobs.Checkpoint, size int64,
+) (uploadCheckpoint, error) {
+	input := &obs.InitiateMultipartUploadInput{}
+	input.Bucket = s.bucket
+	input.Key = path
+
+	output, err := s.obsClient.InitiateMultipartUpload(input)
+	if err != nil {
+		return uploadCheckpoint{}, err
+	}
+
+	cp := uploadCheckpoint{
+		Path:     path,
+		Version:  checkpoint.Version,
+		Size:     size,
+		UploadId: output.UploadId,
+	}
+
+	return cp, cp.save(checkpoint.File)
+}
+
+func (s *obsImpl) abortUpload(cp *uploadCheckpoint) {
+	input := &obs.AbortMultipartUploadInput{}
+	input.Bucket = s.bucket
+	input.Key = cp.Path
+	input.UploadId = cp.UploadId
+
+	_, _ = s.obsClient.AbortMultipartUpload(input)
+}
+
+// listParts returns the uploaded parts whose key is the part number.
+func (s *obsImpl) listParts(cp *uploadCheckpoint) (map[int]obs.Part, error) {
+	r := map[int]obs.Part{}
+
+	input := &obs.ListPartsInput{}
+	input.Bucket = s.bucket
+	input.Key = cp.Path
+	input.UploadId = cp.UploadId
+	input.MaxParts = 1000
+
+	for {
+		output, err := s.obsClient.ListParts(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range output.Parts {
+			r[p.PartNumber] = p
+		}
+
+		if !output.IsTruncated {
+			return r, nil
+		}
+
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+// uploadParts uploads the parts which are not uploaded by uploadTaskNum
+// workers.
+func (s *obsImpl) uploadParts(
+	cp *uploadCheckpoint, file string, parts map[int]obs.Part, limiter dobs.Limiter,
+) ([]obs.Part, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	size := cp.Size
+	n := int((size + uploadPartSize - 1) / uploadPartSize)
+	r := make([]obs.Part, n)
+
+	err = utils.Parallel(uploadTaskNum, n, func(i int) error {
+		offset := int64(i) * uploadPartSize
+
+		partSize := size - offset
+		if partSize > uploadPartSize {
+			partSize = uploadPartSize
+		}
+
+		num := i + 1
+
+		if p, ok := parts[num]; ok && p.Size == partSize {
+			r[i] = obs.Part{PartNumber: num, ETag: p.ETag}
+
+			return nil
+		}
+
+		input := &obs.UploadPartInput{}
+		input.Bucket = s.bucket
+		input.Key = cp.Path
+		input.UploadId = cp.UploadId
+		input.PartNumber = num
+		input.PartSize = partSize
+		input.Body = utils.NewLimitedReader(
+			io.NewSectionReader(f, offset, partSize), limiter,
+		)
+
+		output, err := s.obsClient.UploadPart(input)
+		if err != nil {
+			return err
+		}
+
+		r[i] = obs.Part{PartNumber: num, ETag: output.ETag}
+
+		return nil
+	})
+
+	return r, err
+}
@@ -0,0 +1,62 @@
+package obsimpl
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointOfLaterSync(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	// the checkpoint is saved by the earlier sync.
+	saved := uploadCheckpoint{
+		Path: "a/file", Version: "blob1", Size: 10, UploadId: "id",
+	}
+	if err := saved.save(checkpoint); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	cp := loadCheckpoint(checkpoint)
+
+	cases := []struct {
+		name    string
+		path    string
+		version string
+		size    int64
+		want    bool
+	}{
+		{"same content", "a/file", "blob1", 10, true},
+		{"other content", "a/file", "blob2", 10, false},
+		{"other size", "a/file", "blob1", 11, false},
+		{"other object", "b/file", "blob1", 10, false},
+		{"unknown content", "a/file", "", 10, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := cp.isValid(c.path, c.version, c.size); v != c.want {
+				t.Fatalf("isValid = %v, want %v", v, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadOldCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	// the checkpoint saved by the old version is keyed by the local file.
+	v := `{"path":"a/file","file":"/work/sync1/a/file","size":10,"mod_time":1,"upload_id":"id"}`
+	if err := ioutil.WriteFile(checkpoint, []byte(v), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cp := loadCheckpoint(checkpoint)
+	if cp.UploadId != "id" {
+		t.Fatalf("the upload to abort is lost: %+v", cp)
+	}
+
+	if cp.isValid("a/file", "blob1", 10) {
+		t.Fatal("the old checkpoint is valid")
+	}
+}
@@ -3,6 +3,10 @@ package platformimpl
 type Config struct {
 	Token string `json:"token" required:"true"`
 
-	// Host is like https://gitlab.com
+	// Host is like https://gitlab.com, https://github.com or https://gitee.com
 	Host string `json:"host" required:"true"`
+
+	// TypeAttribute is the key of custom attribute of gitlab project whose
+	// value is the resource type. It is only read by the admin token.
+	TypeAttribute string `json:"type_attribute"`
 }
@@ -0,0 +1,16 @@
+package platformimpl
+
+import (
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+)
+
+func NewGitea(cfg *Config) (platform.Platform, error) {
+	api := strings.TrimSuffix(cfg.Host, "/") + "/api/v1"
+
+	return newRESTPlatform(cfg, newRESTClient(api, cfg.Token, false), restOption{
+		pageSize: "limit",
+		repoById: "/repositories/%s",
+	})
+}
@@ -0,0 +1,17 @@
+package platformimpl
+
+import (
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+)
+
+// NewGitee returns the platform of gitee which can't get repo by id,
+// so the mirror can't be moved when the repo is transferred.
+func NewGitee(cfg *Config) (platform.Platform, error) {
+	api := strings.TrimSuffix(cfg.Host, "/") + "/api/v5"
+
+	return newRESTPlatform(cfg, newRESTClient(api, cfg.Token, true), restOption{
+		pageSize: "per_page",
+	})
+}
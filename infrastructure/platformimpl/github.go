@@ -0,0 +1,22 @@
+package platformimpl
+
+import (
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+)
+
+const githubHost = "https://github.com"
+
+func NewGitHub(cfg *Config) (platform.Platform, error) {
+	// the api of github enterprise is host/api/v3
+	api := "https://api.github.com"
+	if h := strings.TrimSuffix(cfg.Host, "/"); h != githubHost {
+		api = h + "/api/v3"
+	}
+
+	return newRESTPlatform(cfg, newRESTClient(api, cfg.Token, false), restOption{
+		pageSize: "per_page",
+		repoById: "/repositories/%s",
+	})
+}
@@ -6,7 +6,9 @@ import (
 
 	gitlab "github.com/xanzy/go-gitlab"
 
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
 )
 
 func NewPlatform(cfg *Config) (platform.Platform, error) {
@@ -23,30 +25,57 @@ func NewPlatform(cfg *Config) (platform.Platform, error) {
 		return nil, err
 	}
 
+	utils.AddSecret(cfg.Token)
+
 	return &platformImpl{
-		cli: cli,
-		endpoint: strings.Replace(
-			strings.TrimSuffix(cfg.Host, "/"), "://",
-			fmt.Sprintf("://%s:%s@", u.Username, cfg.Token), 1,
-		),
+		cli:           cli,
+		endpoint:      strings.TrimSuffix(cfg.Host, "/"),
+		typeAttribute: cfg.TypeAttribute,
+		credential: platform.Credential{
+			Username: u.Username,
+			Password: cfg.Token,
+		},
 	}, nil
 }
 
 type platformImpl struct {
-	cli      *gitlab.Client
-	endpoint string
+	cli           *gitlab.Client
+	endpoint      string
+	typeAttribute string
+	credential    platform.Credential
+}
+
+func (h *platformImpl) GetCredential() platform.Credential {
+	return h.credential
 }
 
 func (h *platformImpl) GetCloneURL(owner, repo string) string {
 	return fmt.Sprintf("%s/%s/%s", h.endpoint, owner, repo)
 }
 
-func (h *platformImpl) GetLastCommit(pid string) (string, error) {
+func (h *platformImpl) GetRepoOwner(pid string) (string, error) {
+	v, _, err := h.cli.Projects.GetProject(pid, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if v.Namespace == nil {
+		return "", fmt.Errorf("no namespace of project:%s", pid)
+	}
+
+	return v.Namespace.Name, nil
+}
+
+func (h *platformImpl) GetLastCommit(repo *platform.Repo, ref string) (string, error) {
 	opts := gitlab.ListCommitsOptions{}
 	opts.Page = 1
 	opts.PerPage = 1
 
-	v, _, err := h.cli.Commits.ListCommits(pid, &opts, nil)
+	if ref != "" {
+		opts.RefName = gitlab.String(shortRefName(ref))
+	}
+
+	v, _, err := h.cli.Commits.ListCommits(repo.Id, &opts, nil)
 
 	if err != nil || len(v) == 0 {
 		return "", err
@@ -54,3 +83,34 @@ func (h *platformImpl) GetLastCommit(pid string) (string, error) {
 
 	return v[0].ID, nil
 }
+
+// GetRepoType finds the type in the custom attribute, the topics and then
+// the namespace of project whose last part is the type, like group/model.
+func (h *platformImpl) GetRepoType(repo *platform.Repo) (domain.ResourceType, error) {
+	var opt *gitlab.GetProjectOptions
+	if h.typeAttribute != "" {
+		opt = &gitlab.GetProjectOptions{WithCustomAttributes: gitlab.Bool(true)}
+	}
+
+	v, _, err := h.cli.Projects.GetProject(repo.Id, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(v.Topics)+2)
+
+	for _, a := range v.CustomAttributes {
+		if a != nil && a.Key == h.typeAttribute {
+			values = append(values, a.Value)
+		}
+	}
+
+	values = append(values, v.Topics...)
+
+	if v.Namespace != nil {
+		items := strings.Split(v.Namespace.FullPath, "/")
+		values = append(values, items[len(items)-1])
+	}
+
+	return findResourceType(values...), nil
+}
@@ -0,0 +1,19 @@
+package platformimpl
+
+import "strings"
+
+const (
+	refBranchPrefix = "refs/heads/"
+	refTagPrefix    = "refs/tags/"
+)
+
+// shortRefName returns the name of branch or tag without the prefix of
+// full ref, like dev of refs/heads/dev, which is accepted by the apis of
+// all the platforms.
+func shortRefName(ref string) string {
+	if strings.HasPrefix(ref, refBranchPrefix) {
+		return strings.TrimPrefix(ref, refBranchPrefix)
+	}
+
+	return strings.TrimPrefix(ref, refTagPrefix)
+}
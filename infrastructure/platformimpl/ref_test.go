@@ -0,0 +1,22 @@
+package platformimpl
+
+import "testing"
+
+func TestShortRefName(t *testing.T) {
+	cases := []struct {
+		ref  string
+		want string
+	}{
+		{"refs/heads/dev", "dev"},
+		{"refs/heads/release/1.x", "release/1.x"},
+		{"refs/tags/v1.0", "v1.0"},
+		{"refs/heads/refs/tags/v1", "refs/tags/v1"},
+		{"dev", "dev"},
+	}
+
+	for _, c := range cases {
+		if v := shortRefName(c.ref); v != c.want {
+			t.Errorf("shortRefName(%q) = %q, want %q", c.ref, v, c.want)
+		}
+	}
+}
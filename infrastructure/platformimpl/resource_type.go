@@ -0,0 +1,14 @@
+package platformimpl
+
+import "github.com/opensourceways/robot-gitlab-sync-repo/domain"
+
+// findResourceType returns the first one of values which is a resource type.
+func findResourceType(values ...string) domain.ResourceType {
+	for _, v := range values {
+		if t, err := domain.NewResourceType(v); err == nil && t != nil {
+			return t
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package platformimpl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+// restClient calls the REST api of github, gitea and gitee which are
+// similar to each other.
+type restClient struct {
+	api   string
+	token string
+
+	// tokenInQuery passes token by the query of access_token instead of
+	// the header of Authorization.
+	tokenInQuery bool
+
+	hc http.Client
+}
+
+func newRESTClient(api, token string, tokenInQuery bool) restClient {
+	utils.AddSecret(token)
+
+	return restClient{
+		api:          strings.TrimSuffix(api, "/"),
+		token:        token,
+		tokenInQuery: tokenInQuery,
+		hc:           http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *restClient) get(path string, query url.Values, result interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	if c.tokenInQuery {
+		query.Set("access_token", c.token)
+	}
+
+	u := c.api + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if !c.tokenInQuery {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		// the url may contain the token.
+		if v, ok := err.(*url.Error); ok {
+			err = v.Err
+		}
+
+		return fmt.Errorf("request %s failed, err:%s", path, err.Error())
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request %s failed, status:%d, body:%s", path, resp.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+type restUser struct {
+	Login string `json:"login"`
+}
+
+type restCommit struct {
+	SHA string `json:"sha"`
+}
+
+type restRepo struct {
+	Owner  restUser `json:"owner"`
+	Topics []string `json:"topics"`
+}
+
+// restOption is the difference between the REST platforms.
+type restOption struct {
+	// pageSize is the name of query to set the number of items per page.
+	pageSize string
+
+	// repoById is the api path to get repo by id. It is empty
+	// if the platform does not support.
+	repoById string
+}
+
+// newRESTPlatform returns the platform whose clone url is like host/owner/repo.git
+func newRESTPlatform(cfg *Config, cli restClient, opt restOption) (platform.Platform, error) {
+	var u restUser
+	if err := cli.get("/user", nil, &u); err != nil {
+		return nil, err
+	}
+
+	return &restPlatform{
+		cli:      cli,
+		opt:      opt,
+		endpoint: strings.TrimSuffix(cfg.Host, "/"),
+		credential: platform.Credential{
+			Username: u.Login,
+			Password: cfg.Token,
+		},
+	}, nil
+}
+
+type restPlatform struct {
+	cli        restClient
+	opt        restOption
+	endpoint   string
+	credential platform.Credential
+}
+
+func (p *restPlatform) GetCredential() platform.Credential {
+	return p.credential
+}
+
+func (p *restPlatform) GetCloneURL(owner, repo string) string {
+	return fmt.Sprintf("%s/%s/%s.git", p.endpoint, owner, repo)
+}
+
+func (p *restPlatform) GetRepoOwner(pid string) (string, error) {
+	if p.opt.repoById == "" {
+		return "", errors.New("getting repo by id is not supported")
+	}
+
+	var v restRepo
+	if err := p.cli.get(fmt.Sprintf(p.opt.repoById, pid), nil, &v); err != nil {
+		return "", err
+	}
+
+	return v.Owner.Login, nil
+}
+
+// GetRepoType finds the type in the topics of repo.
+func (p *restPlatform) GetRepoType(repo *platform.Repo) (domain.ResourceType, error) {
+	var v restRepo
+
+	path := fmt.Sprintf("/repos/%s/%s", repo.Owner, repo.Name)
+	if err := p.cli.get(path, nil, &v); err != nil {
+		return nil, err
+	}
+
+	return findResourceType(v.Topics...), nil
+}
+
+func (p *restPlatform) GetLastCommit(repo *platform.Repo, ref string) (string, error) {
+	q := url.Values{}
+	q.Set(p.opt.pageSize, "1")
+
+	// the default branch is used if sha is not set.
+	if ref != "" {
+		q.Set("sha", shortRefName(ref))
+	}
+
+	var v []restCommit
+
+	path := fmt.Sprintf("/repos/%s/%s/commits", repo.Owner, repo.Name)
+	if err := p.cli.get(path, q, &v); err != nil || len(v) == 0 {
+		return "", err
+	}
+
+	return v[0].SHA, nil
+}
@@ -0,0 +1,111 @@
+package redislockimpl
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Client is the commands of redis which the lock depends on.
+type Client interface {
+	// SetNX sets the key with ttl only if it doesn't exist.
+	SetNX(key, value string, ttl time.Duration) (bool, error)
+	// Get returns the value and ttl of key. The value is empty if the
+	// key doesn't exist.
+	Get(key string) (string, time.Duration, error)
+	Incr(key string) (int64, error)
+	// CompareAndExpire resets the ttl of key only if its value is the same.
+	CompareAndExpire(key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete deletes the key only if its value is the same.
+	CompareAndDelete(key, value string) (bool, error)
+	// Keys returns all the keys with the prefix.
+	Keys(prefix string) ([]string, error)
+}
+
+var (
+	compareAndExpire = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	compareAndDelete = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+func NewClient(cfg *Config) (Client, error) {
+	cli := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	if err := cli.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+
+	return redisClient{cli}, nil
+}
+
+type redisClient struct {
+	cli *redis.Client
+}
+
+func (c redisClient) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	return c.cli.SetNX(context.Background(), key, value, ttl).Result()
+}
+
+func (c redisClient) Get(key string) (string, time.Duration, error) {
+	ctx := context.Background()
+
+	pipe := c.cli.Pipeline()
+	v := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		if err == redis.Nil {
+			err = nil
+		}
+
+		return "", 0, err
+	}
+
+	return v.Val(), ttl.Val(), nil
+}
+
+func (c redisClient) Incr(key string) (int64, error) {
+	return c.cli.Incr(context.Background(), key).Result()
+}
+
+func (c redisClient) CompareAndExpire(key, value string, ttl time.Duration) (bool, error) {
+	n, err := compareAndExpire.Run(
+		context.Background(), c.cli, []string{key}, value, ttl.Milliseconds(),
+	).Int()
+
+	return n == 1, err
+}
+
+func (c redisClient) CompareAndDelete(key, value string) (bool, error) {
+	n, err := compareAndDelete.Run(
+		context.Background(), c.cli, []string{key}, value,
+	).Int()
+
+	return n == 1, err
+}
+
+func (c redisClient) Keys(prefix string) ([]string, error) {
+	ctx := context.Background()
+
+	var r []string
+
+	iter := c.cli.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		r = append(r, iter.Val())
+	}
+
+	return r, iter.Err()
+}
@@ -0,0 +1,16 @@
+package redislockimpl
+
+type Config struct {
+	Address  string `json:"address"   required:"true"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+
+	// KeyPrefix is the prefix of keys, so that the redis can be shared.
+	KeyPrefix string `json:"key_prefix"`
+}
+
+func (cfg *Config) SetDefault() {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "repo_sync_lock"
+	}
+}
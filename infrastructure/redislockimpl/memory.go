@@ -0,0 +1,131 @@
+package redislockimpl
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryClient returns the Client which keeps the keys in memory. It
+// stands in for redis when testing or running a single instance.
+func NewMemoryClient() Client {
+	return &memoryClient{items: map[string]memoryItem{}, now: time.Now}
+}
+
+type memoryItem struct {
+	value string
+	// expiry is zero if the key never expires.
+	expiry time.Time
+}
+
+type memoryClient struct {
+	lock  sync.Mutex
+	items map[string]memoryItem
+	now   func() time.Time
+}
+
+// get must be called with lock held.
+func (c *memoryClient) get(key string) (memoryItem, bool) {
+	v, ok := c.items[key]
+	if ok && !v.expiry.IsZero() && !c.now().Before(v.expiry) {
+		delete(c.items, key)
+
+		return v, false
+	}
+
+	return v, ok
+}
+
+func (c *memoryClient) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.get(key); ok {
+		return false, nil
+	}
+
+	c.items[key] = memoryItem{value: value, expiry: c.now().Add(ttl)}
+
+	return true, nil
+}
+
+func (c *memoryClient) Get(key string) (string, time.Duration, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.get(key)
+	if !ok {
+		return "", 0, nil
+	}
+
+	if v.expiry.IsZero() {
+		return v.value, -1, nil
+	}
+
+	return v.value, v.expiry.Sub(c.now()), nil
+}
+
+func (c *memoryClient) Incr(key string) (int64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.get(key)
+	if !ok {
+		v = memoryItem{value: "0"}
+	}
+
+	n, err := strconv.ParseInt(v.value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	n++
+	v.value = strconv.FormatInt(n, 10)
+	c.items[key] = v
+
+	return n, nil
+}
+
+func (c *memoryClient) CompareAndExpire(key, value string, ttl time.Duration) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.get(key)
+	if !ok || v.value != value {
+		return false, nil
+	}
+
+	v.expiry = c.now().Add(ttl)
+	c.items[key] = v
+
+	return true, nil
+}
+
+func (c *memoryClient) CompareAndDelete(key, value string) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	v, ok := c.get(key)
+	if !ok || v.value != value {
+		return false, nil
+	}
+
+	delete(c.items, key)
+
+	return true, nil
+}
+
+func (c *memoryClient) Keys(prefix string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var r []string
+	for k := range c.items {
+		if _, ok := c.get(k); ok && strings.HasPrefix(k, prefix) {
+			r = append(r, k)
+		}
+	}
+
+	return r, nil
+}
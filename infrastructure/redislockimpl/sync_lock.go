@@ -0,0 +1,403 @@
+package redislockimpl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+)
+
+var errLockLost = synclock.NewErrorConcurrentUpdating(
+	errors.New("the sync lock is lost, it expired or was taken over"),
+)
+
+// NewRepoSyncLock returns the synclock.RepoSyncLock which keeps the running
+// sync in redis and the rest, like LastCommit, in the durable store.
+//
+// The lock of running sync is a key whose value is "fence:holder" and ttl
+// is the lease, so it is released automatically when the lease expires.
+// Fence is increased on every acquisition, and the lock is only renewed or
+// released by the one who has the same fence. The fence is saved in the
+// durable store too, which rejects the result saved by the one whose fence
+// is older, because the lock may expire after it is checked in redis.
+func NewRepoSyncLock(durable synclock.RepoSyncLock, cli Client, cfg *Config) synclock.RepoSyncLock {
+	return syncLock{
+		durable:  durable,
+		cli:      cli,
+		lockKey:  cfg.KeyPrefix + ":lock:",
+		fenceKey: cfg.KeyPrefix + ":fence",
+	}
+}
+
+type syncLock struct {
+	durable  synclock.RepoSyncLock
+	cli      Client
+	lockKey  string
+	fenceKey string
+}
+
+func (impl syncLock) Save(p *domain.RepoSyncLock) (domain.RepoSyncLock, error) {
+	if p.IsRunning() {
+		if p.Fence == 0 {
+			return impl.acquire(p)
+		}
+
+		return impl.renew(p)
+	}
+
+	if p.Fence != 0 {
+		return impl.release(p)
+	}
+
+	return impl.saveDurable(p)
+}
+
+func (impl syncLock) acquire(p *domain.RepoSyncLock) (r domain.RepoSyncLock, err error) {
+	ttl, err := leaseTTL(p)
+	if err != nil {
+		return
+	}
+
+	fence, err := impl.cli.Incr(impl.fenceKey)
+	if err != nil {
+		return
+	}
+
+	key := impl.key(p.Owner.Account(), p.RepoId, p.Ref)
+	value := lockValue(fence, p.Holder)
+
+	ok, err := impl.cli.SetNX(key, value, ttl)
+	if err != nil {
+		return
+	}
+
+	if !ok {
+		err = errors.New("the repo is being synced by others")
+
+		return
+	}
+
+	// saving the fence changes the version of durable record, so the
+	// previous holder can't save its result any more. It fails if the
+	// previous holder has just saved, and the sync should be retried.
+	v := *p
+	v.Fence = fence
+
+	if r, err = impl.durable.Save(&v); err != nil {
+		impl.cli.CompareAndDelete(key, value)
+	}
+
+	return
+}
+
+func (impl syncLock) renew(p *domain.RepoSyncLock) (r domain.RepoSyncLock, err error) {
+	ttl, err := leaseTTL(p)
+	if err != nil {
+		return
+	}
+
+	key, value, err := impl.held(p)
+	if err != nil {
+		return
+	}
+
+	ok, err := impl.cli.CompareAndExpire(key, value, ttl)
+	if err != nil {
+		return
+	}
+
+	if !ok {
+		err = errLockLost
+
+		return
+	}
+
+	return *p, nil
+}
+
+// release saves the last commit only if the lock is still held, so that
+// the one whose lease expired can't overwrite the result of new holder.
+func (impl syncLock) release(p *domain.RepoSyncLock) (r domain.RepoSyncLock, err error) {
+	key, value, err := impl.held(p)
+	if err != nil {
+		return
+	}
+
+	if r, err = impl.saveDurable(p); err != nil {
+		return
+	}
+
+	_, err = impl.cli.CompareAndDelete(key, value)
+
+	return
+}
+
+// held returns the key and value of lock if it is held by p.
+func (impl syncLock) held(p *domain.RepoSyncLock) (string, string, error) {
+	key := impl.key(p.Owner.Account(), p.RepoId, p.Ref)
+
+	value, _, err := impl.cli.Get(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if fence, _ := parseLockValue(value); fence != p.Fence {
+		return "", "", errLockLost
+	}
+
+	return key, value, nil
+}
+
+// saveDurable saves the lock which is not running to the durable store.
+// The fence of the releasing one is saved too, and the durable store fails
+// if it is older than the saved one.
+func (impl syncLock) saveDurable(p *domain.RepoSyncLock) (domain.RepoSyncLock, error) {
+	v := *p
+	v.Holder = ""
+	v.Expiry = 0
+
+	r, err := impl.durable.Save(&v)
+	r.Fence = 0
+
+	return r, err
+}
+
+func (impl syncLock) Find(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error) {
+	r, err := impl.durable.Find(owner, repoId, ref)
+	if err != nil {
+		return r, err
+	}
+
+	return r, impl.fill(&r)
+}
+
+func (impl syncLock) FindByRepo(repoId string) ([]domain.RepoSyncLock, error) {
+	v, err := impl.durable.FindByRepo(repoId)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, impl.fillAll(v)
+}
+
+// List filters the running locks in redis and the others in the durable
+// store, so the page of locks which are not running may be less than Limit.
+// The lock whose holder crashed is running until it is taken over.
+func (impl syncLock) List(opt *synclock.ListOption) ([]domain.RepoSyncLock, error) {
+	running := domain.RepoSyncStatusRunning.RepoSyncStatus()
+
+	if opt.Status == running {
+		return impl.listRunning(opt)
+	}
+
+	v, err := impl.durable.List(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := impl.fillAll(v); err != nil {
+		return nil, err
+	}
+
+	if opt.Status == "" {
+		return v, nil
+	}
+
+	r := v[:0]
+	for i := range v {
+		if !v[i].IsRunning() {
+			r = append(r, v[i])
+		}
+	}
+
+	return r, nil
+}
+
+// listRunning lists the locks held in redis, and the ones whose holders
+// crashed, which are still running in the durable store after their keys
+// in redis expire.
+func (impl syncLock) listRunning(opt *synclock.ListOption) ([]domain.RepoSyncLock, error) {
+	keys, err := impl.cli.Keys(impl.lockKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys, err = impl.addCrashed(keys, opt.Owner); err != nil {
+		return nil, err
+	}
+
+	if opt.Owner != "" {
+		prefix := impl.lockKey + opt.Owner + ":"
+
+		r := keys[:0]
+		for _, k := range keys {
+			if strings.HasPrefix(k, prefix) {
+				r = append(r, k)
+			}
+		}
+
+		keys = r
+	}
+
+	sort.Strings(keys)
+
+	if opt.Offset >= len(keys) {
+		return nil, nil
+	}
+
+	keys = keys[opt.Offset:]
+	if opt.Limit > 0 && opt.Limit < len(keys) {
+		keys = keys[:opt.Limit]
+	}
+
+	r := make([]domain.RepoSyncLock, 0, len(keys))
+
+	for _, k := range keys {
+		items := strings.SplitN(strings.TrimPrefix(k, impl.lockKey), ":", 3)
+		if len(items) != 3 {
+			continue
+		}
+
+		owner, err := domain.NewAccount(items[0])
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := impl.Find(owner, items[1], items[2])
+		if err != nil {
+			if synclock.IsRepoSyncLockNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		r = append(r, v)
+	}
+
+	return r, nil
+}
+
+// addCrashed adds the keys of the running locks in the durable store which
+// are not in keys.
+func (impl syncLock) addCrashed(keys []string, owner string) ([]string, error) {
+	v, err := impl.durable.List(&synclock.ListOption{
+		Owner:  owner,
+		Status: domain.RepoSyncStatusRunning.RepoSyncStatus(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		held[k] = true
+	}
+
+	for i := range v {
+		k := impl.key(v[i].Owner.Account(), v[i].RepoId, v[i].Ref)
+		if !held[k] {
+			held[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+// Remove removes the lock of running sync too if it is held by p.
+func (impl syncLock) Remove(p *domain.RepoSyncLock) error {
+	if err := impl.durable.Remove(p); err != nil {
+		return err
+	}
+
+	if p.Fence == 0 {
+		return nil
+	}
+
+	key, value, err := impl.held(p)
+	if err != nil {
+		if err == errLockLost {
+			return nil
+		}
+
+		return err
+	}
+
+	_, err = impl.cli.CompareAndDelete(key, value)
+
+	return err
+}
+
+func (impl syncLock) fillAll(v []domain.RepoSyncLock) error {
+	for i := range v {
+		if err := impl.fill(&v[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fill sets the state of running sync if it exists. The fence saved in
+// the durable store is of the last acquisition, and it is only kept if
+// the lock is still held.
+func (impl syncLock) fill(r *domain.RepoSyncLock) error {
+	r.Fence = 0
+
+	value, ttl, err := impl.cli.Get(impl.key(r.Owner.Account(), r.RepoId, r.Ref))
+	if err != nil || value == "" {
+		return err
+	}
+
+	fence, holder := parseLockValue(value)
+	if fence == 0 {
+		return fmt.Errorf("invalid value of sync lock: %s", value)
+	}
+
+	r.Status = domain.RepoSyncStatusRunning
+	r.Holder = holder
+	r.Fence = fence
+	r.Expiry = time.Now().Add(ttl).Unix()
+
+	return nil
+}
+
+// key is like "prefix:lock:owner:repo_id:ref", and the ref is the last one
+// because it may contain ":".
+func (impl syncLock) key(owner, repoId, ref string) string {
+	return impl.lockKey + owner + ":" + repoId + ":" + ref
+}
+
+func leaseTTL(p *domain.RepoSyncLock) (time.Duration, error) {
+	ttl := time.Until(time.Unix(p.Expiry, 0))
+	if ttl <= 0 {
+		return 0, errors.New("the lease of sync lock has expired")
+	}
+
+	return ttl, nil
+}
+
+func lockValue(fence int64, holder string) string {
+	return strconv.FormatInt(fence, 10) + ":" + holder
+}
+
+// parseLockValue returns 0 if the value is invalid.
+func parseLockValue(v string) (int64, string) {
+	items := strings.SplitN(v, ":", 2)
+	if len(items) != 2 {
+		return 0, ""
+	}
+
+	fence, err := strconv.ParseInt(items[0], 10, 64)
+	if err != nil {
+		return 0, ""
+	}
+
+	return fence, items[1]
+}
@@ -0,0 +1,308 @@
+package redislockimpl
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/sqldb"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synclockimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
+)
+
+const testRepoId = "1"
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+type testLock struct {
+	synclock.RepoSyncLock
+
+	durable synclock.RepoSyncLock
+	clock   *testClock
+	owner   domain.Account
+}
+
+func newTestLock(t *testing.T) *testLock {
+	dbCfg := sqldb.Config{
+		Conn:      filepath.Join(t.TempDir(), "sync.db"),
+		TableName: "repo_sync_lock",
+	}
+	dbCfg.SetDefault()
+
+	db, err := sqldb.NewSQLite(&dbCfg)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	clock := &testClock{now: time.Now()}
+
+	cli := NewMemoryClient().(*memoryClient)
+	cli.now = clock.Now
+
+	cfg := Config{}
+	cfg.SetDefault()
+
+	durable := synclockimpl.NewRepoSyncLock(sqldb.NewSyncLockMapper(db))
+	owner, _ := domain.NewAccount("owner")
+
+	return &testLock{
+		RepoSyncLock: NewRepoSyncLock(durable, cli, &cfg),
+		durable:      durable,
+		clock:        clock,
+		owner:        owner,
+	}
+}
+
+// start finds the lock of default branch and acquires it for holder.
+func (l *testLock) start(t *testing.T, holder string) (domain.RepoSyncLock, error) {
+	c, err := l.Find(l.owner, testRepoId, "")
+	if err != nil {
+		if !synclock.IsRepoSyncLockNotExist(err) {
+			t.Fatalf("find: %v", err)
+		}
+
+		c.Owner = l.owner
+		c.RepoId = testRepoId
+	}
+
+	// it is a new acquisition even if the lock is held by the others.
+	c.Fence = 0
+
+	if err := c.Start(holder, time.Now().Add(time.Minute).Unix()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	return l.Save(&c)
+}
+
+func (l *testLock) find(t *testing.T) domain.RepoSyncLock {
+	c, err := l.Find(l.owner, testRepoId, "")
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+
+	return c
+}
+
+func (l *testLock) expire() {
+	l.clock.now = l.clock.now.Add(2 * time.Minute)
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	l := newTestLock(t)
+
+	a, err := l.start(t, "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	if a.Fence == 0 {
+		t.Fatal("the fence of acquired lock is 0")
+	}
+
+	if c := l.find(t); !c.IsRunning() || c.Holder != "a" || c.Fence != a.Fence {
+		t.Fatalf("unexpected running lock: %+v", c)
+	}
+
+	if _, err := l.start(t, "b"); err == nil {
+		t.Fatal("acquire the held lock, want error")
+	}
+
+	if err := a.Succeed("commit-a"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if _, err := l.Save(&a); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	c := l.find(t)
+	if c.IsRunning() || c.Fence != 0 || c.LastCommit != "commit-a" {
+		t.Fatalf("unexpected released lock: %+v", c)
+	}
+
+	if _, err := l.start(t, "b"); err != nil {
+		t.Fatalf("acquire the released lock: %v", err)
+	}
+}
+
+func TestTakeoverAfterExpiry(t *testing.T) {
+	l := newTestLock(t)
+
+	a, err := l.start(t, "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	l.expire()
+
+	// the expired one can't renew.
+	if _, err := l.Save(&a); err != errLockLost {
+		t.Fatalf("renew the expired lock: err = %v, want %v", err, errLockLost)
+	}
+
+	b, err := l.start(t, "b")
+	if err != nil {
+		t.Fatalf("take over: %v", err)
+	}
+
+	if b.Fence <= a.Fence {
+		t.Fatalf("fence = %d, want greater than %d", b.Fence, a.Fence)
+	}
+
+	// the durable store saves the fence of new holder.
+	if d, err := l.durable.Find(l.owner, testRepoId, ""); err != nil || d.Fence != b.Fence {
+		t.Fatalf("durable fence = %d, err = %v, want %d", d.Fence, err, b.Fence)
+	}
+
+	if err := a.Succeed("commit-a"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if _, err := l.Save(&a); err == nil {
+		t.Fatal("release the lock taken over, want error")
+	}
+
+	if err := b.Succeed("commit-b"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if _, err := l.Save(&b); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	if c := l.find(t); c.LastCommit != "commit-b" {
+		t.Fatalf("last commit = %s, want commit-b", c.LastCommit)
+	}
+}
+
+// the lock may expire and be taken over after the stale holder checks it
+// in redis, and the durable store must reject its result.
+func TestStaleReleaseAfterCheck(t *testing.T) {
+	l := newTestLock(t)
+
+	a, err := l.start(t, "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	impl := l.RepoSyncLock.(syncLock)
+
+	if _, _, err := impl.held(&a); err != nil {
+		t.Fatalf("check the held lock: %v", err)
+	}
+
+	l.expire()
+
+	if _, err := l.start(t, "b"); err != nil {
+		t.Fatalf("take over: %v", err)
+	}
+
+	if err := a.Succeed("commit-a"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if _, err := impl.saveDurable(&a); err == nil {
+		t.Fatal("save the result of stale holder, want error")
+	}
+
+	if c := l.find(t); c.LastCommit == "commit-a" || c.Holder != "b" {
+		t.Fatalf("the result of new holder is overwritten: %+v", c)
+	}
+}
+
+// the lost lock is still rejected by the fence if the version matches.
+func TestDurableRejectsOlderFence(t *testing.T) {
+	l := newTestLock(t)
+
+	a, err := l.start(t, "a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	if err := a.Abort(); err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+
+	if _, err := l.Save(&a); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	b, err := l.start(t, "b")
+	if err != nil {
+		t.Fatalf("acquire again: %v", err)
+	}
+
+	stale := b
+	stale.Fence = a.Fence
+
+	if err := stale.Succeed("commit-stale"); err != nil {
+		t.Fatalf("succeed: %v", err)
+	}
+
+	if _, err := l.durable.Save(&stale); err == nil {
+		t.Fatal("save with an older fence, want error")
+	}
+}
+
+// the holder crashed, so its key in redis expired but the durable record
+// is still running until it is taken over.
+func TestListCrashedHolder(t *testing.T) {
+	l := newTestLock(t)
+
+	if _, err := l.start(t, "a"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	l.expire()
+
+	d, err := l.durable.Find(l.owner, testRepoId, "")
+	if err != nil || !d.IsRunning() {
+		t.Fatalf("the durable record is not running: %+v, %v", d, err)
+	}
+
+	d.Expiry = time.Now().Add(-time.Minute).Unix()
+	if _, err := l.durable.Save(&d); err != nil {
+		t.Fatalf("save the expiry: %v", err)
+	}
+
+	running := domain.RepoSyncStatusRunning.RepoSyncStatus()
+
+	v, err := l.List(&synclock.ListOption{Status: running})
+	if err != nil {
+		t.Fatalf("list running: %v", err)
+	}
+
+	if len(v) != 1 || v[0].Holder != "a" || v[0].Fence != 0 || !v[0].IsRunning() {
+		t.Fatalf("unexpected running locks: %+v", v)
+	}
+
+	if v, err := l.List(&synclock.ListOption{Owner: "other", Status: running}); err != nil || len(v) != 0 {
+		t.Fatalf("list running of other owner: %+v, %v", v, err)
+	}
+
+	if n, err := sync.CountStuckLocks(l); err != nil || n != 1 {
+		t.Fatalf("stuck locks = %d, err = %v, want 1", n, err)
+	}
+
+	// it is not listed twice after it is taken over.
+	if _, err := l.start(t, "b"); err != nil {
+		t.Fatalf("take over: %v", err)
+	}
+
+	if v, err := l.List(&synclock.ListOption{Status: running}); err != nil || len(v) != 1 || v[0].Holder != "b" {
+		t.Fatalf("unexpected running locks after takeover: %+v, %v", v, err)
+	}
+}
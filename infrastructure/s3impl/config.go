@@ -0,0 +1,12 @@
+package s3impl
+
+type Config struct {
+	AccessKey string `json:"access_key"    required:"true"`
+	SecretKey string `json:"secret_key"    required:"true"`
+	Endpoint  string `json:"endpoint"      required:"true"`
+	Bucket    string `json:"bucket"        required:"true"`
+	Region    string `json:"region"`
+
+	// DisableSSL connects the endpoint by http, like a local MinIO.
+	DisableSSL bool `json:"disable_ssl"`
+}
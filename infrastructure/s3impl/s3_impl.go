@@ -0,0 +1,138 @@
+package s3impl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/sirupsen/logrus"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+)
+
+// NewS3 returns the obs.OBS on any S3 compatible storage, like MinIO.
+func NewS3(cfg *Config) (dobs.OBS, error) {
+	cli, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: !cfg.DisableSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new s3 client failed, err:%s", err.Error())
+	}
+
+	return &s3Impl{
+		cli:      cli,
+		bucket:   cfg.Bucket,
+		partSize: uploadPartSize,
+	}, nil
+}
+
+type s3Impl struct {
+	cli      *minio.Client
+	bucket   string
+	partSize int64
+}
+
+func (s *s3Impl) SaveObject(path, content string) error {
+	_, err := s.cli.PutObject(
+		context.Background(), s.bucket, path,
+		strings.NewReader(content), int64(len(content)),
+		minio.PutObjectOptions{SendContentMd5: true},
+	)
+
+	return err
+}
+
+func (s *s3Impl) CopyObject(dst, src string) error {
+	logrus.Debugf("copy object %s to %s", src, dst)
+
+	_, err := s.cli.CopyObject(
+		context.Background(),
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: src},
+	)
+
+	return err
+}
+
+func (s *s3Impl) DeleteObject(path string) error {
+	logrus.Debugf("delete object %s", path)
+
+	return s.cli.RemoveObject(
+		context.Background(), s.bucket, path, minio.RemoveObjectOptions{},
+	)
+}
+
+func (s *s3Impl) ListObjects(prefix string) ([]dobs.ObjectMeta, error) {
+	var r []dobs.ObjectMeta
+
+	objs := s.cli.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+
+	for item := range objs {
+		if item.Err != nil {
+			return nil, item.Err
+		}
+
+		r = append(r, dobs.ObjectMeta{
+			Path: item.Key,
+			Size: item.Size,
+			ETag: strings.Trim(item.ETag, "\""),
+		})
+	}
+
+	return r, nil
+}
+
+func (s *s3Impl) GetObject(path string) ([]byte, error) {
+	obj, err := s.cli.GetObject(
+		context.Background(), s.bucket, path, minio.GetObjectOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer obj.Close()
+
+	// the error of request is returned when reading.
+	v, err := ioutil.ReadAll(obj)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (s *s3Impl) GetObjectMeta(path string) (*dobs.ObjectMeta, error) {
+	info, err := s.cli.StatObject(
+		context.Background(), s.bucket, path, minio.StatObjectOptions{},
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &dobs.ObjectMeta{
+		Path: path,
+		Size: info.Size,
+		ETag: strings.Trim(info.ETag, "\""),
+	}, nil
+}
+
+func isNotFound(err error) bool {
+	return minio.ToErrorResponse(err).StatusCode == http.StatusNotFound
+}
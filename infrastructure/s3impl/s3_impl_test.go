@@ -0,0 +1,83 @@
+package s3impl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+func TestObjects(t *testing.T) {
+	s, _ := newTestS3(t)
+
+	for _, p := range []string{"repo/a", "repo/dir/b", "repo2/c"} {
+		if err := s.SaveObject(p, p); err != nil {
+			t.Fatalf("save %s: %v", p, err)
+		}
+	}
+
+	if err := s.CopyObject("repo/dir/d", "repo/a"); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	if v, err := s.GetObject("repo/dir/d"); err != nil || string(v) != "repo/a" {
+		t.Fatalf("get copied object: %q, %v", v, err)
+	}
+
+	m, err := s.GetObjectMeta("repo/dir/b")
+	if err != nil || m == nil || m.Size != 10 || m.ETag != utils.GenMD5([]byte("repo/dir/b")) {
+		t.Fatalf("get meta: %+v, %v", m, err)
+	}
+
+	// the quotes of etag are trimmed.
+	if v, _ := s.ListObjects("repo/a"); len(v) != 1 || v[0].ETag != utils.GenMD5([]byte("repo/a")) {
+		t.Fatalf("list etag: %+v", v)
+	}
+
+	// the missing object is not an error.
+	if m, err := s.GetObjectMeta("repo/x"); err != nil || m != nil {
+		t.Fatalf("get meta of missing object: %+v, %v", m, err)
+	}
+
+	if v, err := s.GetObject("repo/x"); err != nil || v != nil {
+		t.Fatalf("get missing object: %q, %v", v, err)
+	}
+
+	list := func(prefix string) []string {
+		v, err := s.ListObjects(prefix)
+		if err != nil {
+			t.Fatalf("list %q: %v", prefix, err)
+		}
+
+		var r []string
+		for i := range v {
+			r = append(r, v[i].Path)
+		}
+
+		return r
+	}
+
+	cases := []struct {
+		prefix string
+		want   []string
+	}{
+		{"repo/", []string{"repo/a", "repo/dir/b", "repo/dir/d"}},
+		{"repo", []string{"repo/a", "repo/dir/b", "repo/dir/d", "repo2/c"}},
+		{"repo/dir/", []string{"repo/dir/b", "repo/dir/d"}},
+		{"none/", nil},
+	}
+
+	for _, c := range cases {
+		if v := list(c.prefix); !reflect.DeepEqual(v, c.want) {
+			t.Errorf("list %q = %v, want %v", c.prefix, v, c.want)
+		}
+	}
+
+	if err := s.DeleteObject("repo/dir/b"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if v := list("repo/dir/"); !reflect.DeepEqual(v, []string{"repo/dir/d"}) {
+		t.Fatalf("list after delete = %v", v)
+	}
+}
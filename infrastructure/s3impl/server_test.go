@@ -0,0 +1,357 @@
+package s3impl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const testBucket = "bucket"
+
+type fakeObject struct {
+	content []byte
+	etag    string
+}
+
+type fakeUpload struct {
+	key   string
+	parts map[int]fakeObject
+}
+
+// fakeS3 is an in-memory S3 server which supports the requests sent by
+// s3Impl. The path style is used, so the path is /bucket/key.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]*fakeUpload
+	nextId  int
+
+	// failPart makes the upload of the part fail if it is not 0.
+	failPart int
+	// requests counts the requests by operation.
+	requests map[string]int
+}
+
+func newTestS3(t *testing.T) (*s3Impl, *fakeS3) {
+	f := &fakeS3{
+		objects:  map[string]fakeObject{},
+		uploads:  map[string]*fakeUpload{},
+		requests: map[string]int{},
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	cli, err := minio.New(strings.TrimPrefix(srv.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("ak", "sk", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	return &s3Impl{cli: cli, bucket: testBucket, partSize: 4}, f
+}
+
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests[op]
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket)
+	key = strings.TrimPrefix(key, "/")
+	q := r.URL.Query()
+
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.requests["list"]++
+		f.list(w, q.Get("prefix"))
+
+	case r.Method == http.MethodPost && hasQuery(q, "uploads"):
+		f.requests["initiate"]++
+		f.nextId++
+		id := strconv.Itoa(f.nextId)
+		f.uploads[id] = &fakeUpload{key: key, parts: map[int]fakeObject{}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: testBucket, Key: key, UploadId: id})
+
+	case hasQuery(q, "uploadId"):
+		f.multipart(w, r, key, q, body)
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.requests["copy"]++
+		src := r.Header.Get("X-Amz-Copy-Source")
+		src = strings.TrimPrefix(strings.TrimPrefix(src, "/"), testBucket+"/")
+
+		obj, ok := f.objects[src]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+
+			return
+		}
+
+		// the copy of multipart object has the md5 etag.
+		f.objects[key] = newFakeObject(obj.content)
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: f.objects[key].etag, LastModified: time.Now().UTC().Format(time.RFC3339)})
+
+	case r.Method == http.MethodPut:
+		f.requests["put"]++
+		f.objects[key] = newFakeObject(body)
+		w.Header().Set("ETag", `"`+f.objects[key].etag+`"`)
+
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		f.requests["get"]++
+
+		obj, ok := f.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+
+			return
+		}
+
+		w.Header().Set("ETag", `"`+obj.etag+`"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.content)))
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.content)
+		}
+
+	case r.Method == http.MethodDelete:
+		f.requests["delete"]++
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "unsupported request", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, key string, q url.Values, body []byte) {
+	id := q.Get("uploadId")
+
+	u, ok := f.uploads[id]
+	if !ok || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		f.requests["part"]++
+
+		num, _ := strconv.Atoi(q.Get("partNumber"))
+		if num == f.failPart {
+			writeError(w, http.StatusForbidden, "AccessDenied")
+
+			return
+		}
+
+		u.parts[num] = newFakeObject(body)
+		w.Header().Set("ETag", `"`+u.parts[num].etag+`"`)
+
+	case http.MethodGet:
+		f.requests["parts"]++
+
+		type part struct {
+			PartNumber int
+			ETag       string
+			Size       int
+		}
+
+		v := struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			Parts   []part   `xml:"Part"`
+		}{}
+
+		for num, p := range u.parts {
+			v.Parts = append(v.Parts, part{num, p.etag, len(p.content)})
+		}
+
+		sort.Slice(v.Parts, func(i, j int) bool {
+			return v.Parts[i].PartNumber < v.Parts[j].PartNumber
+		})
+
+		writeXML(w, v)
+
+	case http.MethodPost:
+		f.requests["complete"]++
+
+		var v struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+
+		if err := xml.Unmarshal(body, &v); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML")
+
+			return
+		}
+
+		var content, sums []byte
+		for _, p := range v.Parts {
+			part, ok := u.parts[p.PartNumber]
+			if !ok || part.etag != strings.Trim(p.ETag, `"`) {
+				writeError(w, http.StatusBadRequest, "InvalidPart")
+
+				return
+			}
+
+			content = append(content, part.content...)
+			sum, _ := hex.DecodeString(part.etag)
+			sums = append(sums, sum...)
+		}
+
+		sum := md5.Sum(sums)
+		etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(v.Parts))
+
+		f.objects[key] = fakeObject{content: content, etag: etag}
+		delete(f.uploads, id)
+
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: testBucket, Key: key, ETag: etag})
+
+	case http.MethodDelete:
+		f.requests["abort"]++
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified string
+	}
+
+	v := struct {
+		XMLName  xml.Name  `xml:"ListBucketResult"`
+		Name     string    `xml:"Name"`
+		Prefix   string    `xml:"Prefix"`
+		Contents []content `xml:"Contents"`
+	}{Name: testBucket, Prefix: prefix}
+
+	for k, obj := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			v.Contents = append(v.Contents, content{
+				k, len(obj.content), `"` + obj.etag + `"`,
+				time.Now().UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	sort.Slice(v.Contents, func(i, j int) bool {
+		return v.Contents[i].Key < v.Contents[j].Key
+	})
+
+	writeXML(w, v)
+}
+
+func hasQuery(q url.Values, key string) bool {
+	_, ok := q[key]
+
+	return ok
+}
+
+func newFakeObject(content []byte) fakeObject {
+	sum := md5.Sum(content)
+
+	return fakeObject{content: content, etag: hex.EncodeToString(sum[:])}
+}
+
+// readBody returns the body, and decodes it if it is sent in aws-chunked
+// encoding of the streaming signature.
+func readBody(r *http.Request) ([]byte, error) {
+	v, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return v, nil
+	}
+
+	var out []byte
+	br := bufio.NewReader(bytes.NewReader(v))
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return out, nil
+		}
+
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+
+		out = append(out, chunk[:size]...)
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
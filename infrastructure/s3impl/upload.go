@@ -0,0 +1,216 @@
+package s3impl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/sirupsen/logrus"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+const uploadPartSize = 16 << 20
+
+// uploadCheckpoint is the multipart upload of the content identified by
+// Version. It is valid no matter where the file is, so that the upload
+// can be resumed by the later sync which checks out the file again.
+type uploadCheckpoint struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Size     int64  `json:"size"`
+	UploadId string `json:"upload_id"`
+}
+
+func (cp *uploadCheckpoint) isValid(path, version string, size int64) bool {
+	return cp.UploadId != "" && version != "" && cp.Path == path &&
+		cp.Version == version && cp.Size == size
+}
+
+func (cp *uploadCheckpoint) save(checkpoint string) error {
+	v, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(checkpoint, v, 0600)
+}
+
+func loadCheckpoint(checkpoint string) (cp uploadCheckpoint) {
+	if v, err := ioutil.ReadFile(checkpoint); err == nil {
+		// the broken checkpoint is same as no checkpoint.
+		_ = json.Unmarshal(v, &cp)
+	}
+
+	return
+}
+
+// UploadFile uploads the file larger than the part size by multipart,
+// and the uploaded parts are skipped when resuming from the checkpoint.
+// Only the parts sent are charged to limiter.
+func (s *s3Impl) UploadFile(path, file string, checkpoint dobs.Checkpoint, limiter dobs.Limiter) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("upload file %s to %s", file, path)
+
+	if info.Size() <= s.partSize {
+		return s.putFile(path, file, info.Size(), limiter)
+	}
+
+	core := minio.Core{Client: s.cli}
+
+	cp := loadCheckpoint(checkpoint.File)
+
+	var parts map[int]minio.ObjectPart
+	if cp.isValid(path, checkpoint.Version, info.Size()) {
+		// the upload may have been aborted or expired.
+		if parts, err = s.listParts(core, &cp); err != nil {
+			logrus.Warnf("resume upload of %s failed, err:%s", path, err.Error())
+		}
+	}
+
+	if parts == nil {
+		if cp.UploadId != "" {
+			_ = core.AbortMultipartUpload(context.Background(), s.bucket, cp.Path, cp.UploadId)
+		}
+
+		cp, err = s.newUpload(core, path, checkpoint, info.Size())
+		if err != nil {
+			return err
+		}
+
+		parts = map[int]minio.ObjectPart{}
+	}
+
+	completed, err := s.uploadParts(core, &cp, file, parts, limiter)
+	if err != nil {
+		return err
+	}
+
+	_, err = core.CompleteMultipartUpload(
+		context.Background(), s.bucket, path, cp.UploadId, completed,
+		minio.PutObjectOptions{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(checkpoint.File); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("remove checkpoint %s failed, err:%s", checkpoint.File, err.Error())
+	}
+
+	return nil
+}
+
+func (s *s3Impl) putFile(path, file string, size int64, limiter dobs.Limiter) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// the md5 is not sent, otherwise the paced reader is read into memory
+	// to calculate it before sending.
+	_, err = s.cli.PutObject(
+		context.Background(), s.bucket, path,
+		utils.NewLimitedReader(f, limiter), size,
+		minio.PutObjectOptions{},
+	)
+
+	return err
+}
+
+func (s *s3Impl) newUpload(
+	core minio.Core, path string, checkpoint dobs.Checkpoint, size int64,
+) (uploadCheckpoint, error) {
+	id, err := core.NewMultipartUpload(
+		context.Background(), s.bucket, path, minio.PutObjectOptions{},
+	)
+	if err != nil {
+		return uploadCheckpoint{}, err
+	}
+
+	cp := uploadCheckpoint{
+		Path:     path,
+		Version:  checkpoint.Version,
+		Size:     size,
+		UploadId: id,
+	}
+
+	return cp, cp.save(checkpoint.File)
+}
+
+// listParts returns the uploaded parts whose key is the part number.
+func (s *s3Impl) listParts(core minio.Core, cp *uploadCheckpoint) (map[int]minio.ObjectPart, error) {
+	r := map[int]minio.ObjectPart{}
+	marker := 0
+
+	for {
+		v, err := core.ListObjectParts(
+			context.Background(), s.bucket, cp.Path, cp.UploadId, marker, 1000,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range v.ObjectParts {
+			r[p.PartNumber] = p
+		}
+
+		if !v.IsTruncated {
+			return r, nil
+		}
+
+		marker = v.NextPartNumberMarker
+	}
+}
+
+func (s *s3Impl) uploadParts(
+	core minio.Core, cp *uploadCheckpoint, file string,
+	parts map[int]minio.ObjectPart, limiter dobs.Limiter,
+) ([]minio.CompletePart, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	size := cp.Size
+	n := int((size + s.partSize - 1) / s.partSize)
+	r := make([]minio.CompletePart, 0, n)
+
+	for i := 1; i <= n; i++ {
+		offset := int64(i-1) * s.partSize
+
+		partSize := size - offset
+		if partSize > s.partSize {
+			partSize = s.partSize
+		}
+
+		p, ok := parts[i]
+		if !ok || p.Size != partSize {
+			p, err = core.PutObjectPart(
+				context.Background(), s.bucket, cp.Path, cp.UploadId, i,
+				utils.NewLimitedReader(io.NewSectionReader(f, offset, partSize), limiter),
+				partSize,
+				minio.PutObjectPartOptions{},
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		r = append(r, minio.CompletePart{PartNumber: i, ETag: p.ETag})
+	}
+
+	return r, nil
+}
@@ -0,0 +1,131 @@
+package s3impl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dobs "github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+)
+
+type nopLimiter struct{}
+
+func (nopLimiter) Wait(int64) {}
+
+// checkout writes the file into a new directory like a sync does.
+func checkout(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "sync", "file")
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	return file
+}
+
+func TestUploadFileResumeByLaterSync(t *testing.T) {
+	s, f := newTestS3(t)
+
+	const content = "0123456789"
+
+	cp := dobs.Checkpoint{
+		File:    filepath.Join(t.TempDir(), "checkpoint"),
+		Version: "blob1",
+	}
+
+	// the first sync fails at the second part.
+	f.failPart = 2
+	if err := s.UploadFile("a/file", checkout(t, content), cp, nopLimiter{}); err == nil {
+		t.Fatal("want error of the first sync")
+	}
+
+	if _, err := os.Stat(cp.File); err != nil {
+		t.Fatalf("the checkpoint is not kept: %v", err)
+	}
+
+	// the later sync checks out the same content to another directory.
+	f.failPart = 0
+	if err := s.UploadFile("a/file", checkout(t, content), cp, nopLimiter{}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	if n := f.count("initiate"); n != 1 {
+		t.Fatalf("initiated %d uploads, want 1", n)
+	}
+
+	if n := f.count("abort"); n != 0 {
+		t.Fatalf("aborted %d uploads, want 0", n)
+	}
+
+	// part 1 is uploaded once, part 2 twice and part 3 once.
+	if n := f.count("part"); n != 4 {
+		t.Fatalf("uploaded %d parts, want 4", n)
+	}
+
+	if v, err := s.GetObject("a/file"); err != nil || string(v) != content {
+		t.Fatalf("get object: %q, %v", v, err)
+	}
+
+	if _, err := os.Stat(cp.File); !os.IsNotExist(err) {
+		t.Fatalf("the checkpoint is not removed: %v", err)
+	}
+}
+
+func TestUploadFileRestartForNewContent(t *testing.T) {
+	s, f := newTestS3(t)
+
+	cp := dobs.Checkpoint{
+		File:    filepath.Join(t.TempDir(), "checkpoint"),
+		Version: "blob1",
+	}
+
+	f.failPart = 2
+	if err := s.UploadFile("a/file", checkout(t, "0123456789"), cp, nopLimiter{}); err == nil {
+		t.Fatal("want error of the first sync")
+	}
+
+	// the file has been changed before the later sync.
+	f.failPart = 0
+	cp.Version = "blob2"
+	if err := s.UploadFile("a/file", checkout(t, "abcdefghij"), cp, nopLimiter{}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if n := f.count("initiate"); n != 2 {
+		t.Fatalf("initiated %d uploads, want 2", n)
+	}
+
+	if n := f.count("abort"); n != 1 {
+		t.Fatalf("aborted %d uploads, want 1", n)
+	}
+
+	if v, err := s.GetObject("a/file"); err != nil || string(v) != "abcdefghij" {
+		t.Fatalf("get object: %q, %v", v, err)
+	}
+}
+
+func TestUploadFileSmall(t *testing.T) {
+	s, f := newTestS3(t)
+
+	cp := dobs.Checkpoint{
+		File:    filepath.Join(t.TempDir(), "checkpoint"),
+		Version: "blob1",
+	}
+
+	if err := s.UploadFile("a/file", checkout(t, "0123"), cp, nopLimiter{}); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if f.count("put") != 1 || f.count("initiate") != 0 {
+		t.Fatalf("the small file is not put at once: %v", f.requests)
+	}
+
+	if v, err := s.GetObject("a/file"); err != nil || string(v) != "0123" {
+		t.Fatalf("get object: %q, %v", v, err)
+	}
+}
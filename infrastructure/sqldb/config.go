@@ -0,0 +1,37 @@
+package sqldb
+
+type Config struct {
+	Conn            string `json:"conn" required:"true"`
+	ConnMaxLifetime int    `json:"conn_max_life_time"`
+	MaxOpenConns    int    `json:"max_open_conns"`
+	MaxIdleConns    int    `json:"max_idle_conns"`
+
+	TableName string `json:"table_name"   required:"true"`
+
+	// TaskTableName is the table of failed syncs to be retried.
+	TaskTableName string `json:"task_table_name"`
+
+	// HistoryTableName is the table of sync attempts.
+	HistoryTableName string `json:"history_table_name"`
+
+	// SchemaTableName is the table of applied migrations.
+	SchemaTableName string `json:"schema_table_name"`
+}
+
+func (cfg *Config) SetDefault() {
+	cfg.ConnMaxLifetime = 900
+	cfg.MaxOpenConns = 3000
+	cfg.MaxIdleConns = 30
+
+	if cfg.TaskTableName == "" {
+		cfg.TaskTableName = "repo_sync_task"
+	}
+
+	if cfg.HistoryTableName == "" {
+		cfg.HistoryTableName = "repo_sync_history"
+	}
+
+	if cfg.SchemaTableName == "" {
+		cfg.SchemaTableName = "repo_sync_schema"
+	}
+}
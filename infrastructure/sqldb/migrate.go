@@ -0,0 +1,212 @@
+package sqldb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migration is a versioned change of schema. The applied versions are
+// saved in the schema table, so each migration is applied only once.
+// It must be idempotent, because the tables may be created by hand or
+// the instances may migrate at the same time. It changes the schema by
+// the frozen schemas in migrate_schema.go instead of the models.
+type migration struct {
+	version     int
+	description string
+	up          func(*Client) error
+}
+
+// migrations can only be appended, and the version increases one by one.
+var migrations = []migration{
+	{1, "create the tables of locks, tasks and histories", (*Client).createTables},
+	{2, "add the unique keys of refs and the index of histories", (*Client).createIndexes},
+	{3, "add the failures and last error of locks", (*Client).upgradeLockStatus},
+	{4, "add the fence of locks", (*Client).addLockFence},
+	{5, "add the mismatches of histories", (*Client).addHistoryMismatches},
+	{6, "add the action of tasks", (*Client).addTaskAction},
+}
+
+// Migrate upgrades the schema to the latest version and returns it.
+func (c *Client) Migrate() (int, error) {
+	if err := c.schemaTable().AutoMigrate(&SchemaVersion{}); err != nil {
+		return 0, err
+	}
+
+	version, err := c.schemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range migrations {
+		m := &migrations[i]
+		if m.version <= version {
+			continue
+		}
+
+		if err := m.up(c); err != nil {
+			return version, fmt.Errorf(
+				"migrate to version %d failed, err:%s", m.version, err.Error(),
+			)
+		}
+
+		err := c.schemaTable().Create(&SchemaVersion{
+			Version:     m.version,
+			Description: m.description,
+			AppliedAt:   time.Now().Unix(),
+		}).Error
+		// the other instance has applied it.
+		if err != nil && !c.isDuplicate(err) {
+			return version, err
+		}
+
+		version = m.version
+	}
+
+	return version, nil
+}
+
+func (c *Client) schemaVersion() (int, error) {
+	var v []int
+
+	err := c.schemaTable().Order(fieldVersion+" desc").Limit(1).
+		Pluck(fieldVersion, &v).Error
+	if err != nil || len(v) == 0 {
+		return 0, err
+	}
+
+	return v[0], nil
+}
+
+// createTables creates the tables, or adds the missing columns if the
+// tables exist.
+func (c *Client) createTables() error {
+	if err := c.lockTable().AutoMigrate(&lockV1{}); err != nil {
+		return err
+	}
+
+	if err := c.taskTable().AutoMigrate(&taskV1{}); err != nil {
+		return err
+	}
+
+	return c.historyTable().AutoMigrate(&historyV1{})
+}
+
+// createIndexes fails if there are duplicate refs which must be cleaned
+// by hand.
+func (c *Client) createIndexes() error {
+	if err := c.fillEmptyRefs(); err != nil {
+		return err
+	}
+
+	ref := []string{fieldOwner, fieldRepoId, fieldRef}
+
+	err := c.createIndex(c.lockTable(), &lockV1{}, c.cfg.TableName, "ref_uk", true, ref...)
+	if err != nil {
+		return err
+	}
+
+	err = c.createIndex(c.taskTable(), &taskV1{}, c.cfg.TaskTableName, "ref_uk", true, ref...)
+	if err != nil {
+		return err
+	}
+
+	return c.createIndex(
+		c.historyTable(), &historyV1{}, c.cfg.HistoryTableName, "ref_idx", false,
+		append(ref, fieldStartTime)...,
+	)
+}
+
+// fillEmptyRefs sets the ref of the records saved before the ref column
+// exists to empty which is the default branch. Otherwise they can't be
+// found by ref, and the unique key ignores them because they are NULL.
+func (c *Client) fillEmptyRefs() error {
+	for _, tx := range []*gorm.DB{c.lockTable(), c.taskTable(), c.historyTable()} {
+		err := tx.Where(fieldRef+" IS NULL").Update(fieldRef, "").Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upgradeLockStatus adds the columns and renames the old status of "done"
+// to "succeeded". The instances of the old version must be stopped before
+// it, because they can't read the statuses other than "done" and "running".
+// The "done" saved by them is still valid to the new version.
+func (c *Client) upgradeLockStatus() error {
+	if err := c.addColumns(c.lockTable(), &lockV3{}, "Failures", "LastError"); err != nil {
+		return err
+	}
+
+	return c.lockTable().
+		Where(map[string]interface{}{fieldStatus: lockStatusDone}).
+		Update(fieldStatus, lockStatusSucceeded).Error
+}
+
+func (c *Client) addLockFence() error {
+	return c.addColumns(c.lockTable(), &lockV4{}, "Fence")
+}
+
+func (c *Client) addHistoryMismatches() error {
+	return c.addColumns(c.historyTable(), &historyV5{}, "Mismatches")
+}
+
+func (c *Client) addTaskAction() error {
+	return c.addColumns(c.taskTable(), &taskV6{}, "Action")
+}
+
+// addColumns adds the fields of model as the columns which don't exist.
+func (c *Client) addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	m := tx.Migrator()
+
+	for _, f := range fields {
+		if m.HasColumn(model, f) {
+			continue
+		}
+
+		// the other instance may have added it at the same time.
+		if err := m.AddColumn(model, f); err != nil && !m.HasColumn(model, f) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createIndex names the index with the table name as the prefix, because
+// the name of index is unique in the database for some databases.
+func (c *Client) createIndex(
+	tx *gorm.DB, model interface{}, table, suffix string, unique bool, columns ...string,
+) error {
+	name := table + "_" + suffix
+
+	if tx.Migrator().HasIndex(model, name) {
+		return nil
+	}
+
+	sql := "CREATE INDEX ? ON ? (%s)"
+	if unique {
+		sql = "CREATE UNIQUE INDEX ? ON ? (%s)"
+	}
+
+	vars := []interface{}{clause.Column{Name: name}, clause.Table{Name: table}}
+	for _, v := range columns {
+		vars = append(vars, clause.Column{Name: v})
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+
+	err := c.db.Exec(fmt.Sprintf(sql, placeholders), vars...).Error
+	// the other instance may have created it at the same time, and mysql
+	// doesn't support "IF NOT EXISTS" of index.
+	if err != nil && tx.Migrator().HasIndex(model, name) {
+		return nil
+	}
+
+	return err
+}
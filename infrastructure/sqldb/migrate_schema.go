@@ -0,0 +1,74 @@
+package sqldb
+
+// The schemas below are the columns added by each migration. They are frozen
+// once released, so that a migration always makes the same change no matter
+// how the models in table.go change later. A new column must be added by a
+// new migration with its own schema.
+
+// lockV1 is the table of locks created by version 1.
+type lockV1 struct {
+	Id         int    `gorm:"column:id;primaryKey"`
+	Owner      string `gorm:"column:owner;size:100"`
+	RepoId     string `gorm:"column:repo_id;size:64"`
+	Ref        string `gorm:"column:ref;size:255;not null;default:''"`
+	RepoType   string `gorm:"column:repo_type;size:32"`
+	Status     string `gorm:"column:status;size:32"`
+	Version    int    `gorm:"column:version"`
+	LastCommit string `gorm:"column:last_commit;size:64"`
+	Holder     string `gorm:"column:holder;size:255"`
+	Expiry     int64  `gorm:"column:expiry"`
+}
+
+// taskV1 is the table of tasks created by version 1.
+type taskV1 struct {
+	Id        int    `gorm:"column:id;primaryKey"`
+	Owner     string `gorm:"column:owner;size:100"`
+	RepoId    string `gorm:"column:repo_id;size:64"`
+	RepoName  string `gorm:"column:repo_name;size:255"`
+	Ref       string `gorm:"column:ref;size:255;not null;default:''"`
+	Status    string `gorm:"column:status;size:32"`
+	Attempts  int    `gorm:"column:attempts"`
+	LastError string `gorm:"column:last_error"`
+	NextRetry int64  `gorm:"column:next_retry"`
+	Version   int    `gorm:"column:version"`
+}
+
+// historyV1 is the table of histories created by version 1.
+type historyV1 struct {
+	Id         int    `gorm:"column:id;primaryKey"`
+	Owner      string `gorm:"column:owner;size:100"`
+	RepoId     string `gorm:"column:repo_id;size:64"`
+	Ref        string `gorm:"column:ref;size:255;not null;default:''"`
+	StartTime  int64  `gorm:"column:start_time"`
+	EndTime    int64  `gorm:"column:end_time"`
+	FromCommit string `gorm:"column:from_commit;size:64"`
+	ToCommit   string `gorm:"column:to_commit;size:64"`
+	Added      int    `gorm:"column:added"`
+	Modified   int    `gorm:"column:modified"`
+	Deleted    int    `gorm:"column:deleted"`
+	LFSCopied  int    `gorm:"column:lfs_copied"`
+	Bytes      int64  `gorm:"column:bytes"`
+	Outcome    string `gorm:"column:outcome;size:32"`
+	Error      string `gorm:"column:error"`
+}
+
+// lockV3 is the columns of locks added by version 3.
+type lockV3 struct {
+	Failures  int    `gorm:"column:failures"`
+	LastError string `gorm:"column:last_error"`
+}
+
+// lockV4 is the columns of locks added by version 4.
+type lockV4 struct {
+	Fence int64 `gorm:"column:fence;not null;default:0"`
+}
+
+// historyV5 is the columns of histories added by version 5.
+type historyV5 struct {
+	Mismatches string `gorm:"column:mismatches"`
+}
+
+// taskV6 is the columns of tasks added by version 6.
+type taskV6 struct {
+	Action string `gorm:"column:action;size:32;not null;default:''"`
+}
@@ -0,0 +1,189 @@
+package sqldb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synclockimpl"
+)
+
+// the table of locks before the ref and the other columns are added.
+const legacyLockTable = `CREATE TABLE repo_sync_lock (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner TEXT,
+	repo_id TEXT,
+	status TEXT,
+	version INTEGER,
+	last_commit TEXT
+)`
+
+func newTestSQLite(t *testing.T) *Client {
+	cfg := Config{
+		Conn:      filepath.Join(t.TempDir(), "sync.db"),
+		TableName: "repo_sync_lock",
+	}
+	cfg.SetDefault()
+
+	cli, err := NewSQLite(&cfg)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	return cli
+}
+
+func TestMigrateLegacyLockTable(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	if err := cli.db.Exec(legacyLockTable).Error; err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+
+	err := cli.db.Exec(
+		"INSERT INTO repo_sync_lock (owner, repo_id, status, version, last_commit) VALUES (?, ?, ?, ?, ?)",
+		"owner", "1", lockStatusDone, 3, "abc",
+	).Error
+	if err != nil {
+		t.Fatalf("insert legacy lock: %v", err)
+	}
+
+	v, err := cli.Migrate()
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if v != migrations[len(migrations)-1].version {
+		t.Fatalf("version = %d, want %d", v, migrations[len(migrations)-1].version)
+	}
+
+	mapper := NewSyncLockMapper(cli)
+
+	do, err := mapper.Get("owner", "1", "")
+	if err != nil {
+		t.Fatalf("get the lock of default branch: %v", err)
+	}
+
+	if do.LastCommit != "abc" || do.Status != lockStatusSucceeded || do.Version != 3 {
+		t.Fatalf("unexpected lock after migration: %+v", do)
+	}
+
+	// the default branch can't be inserted again.
+	_, err = mapper.Insert(&synclockimpl.RepoSyncLockDO{
+		Owner:  "owner",
+		RepoId: "1",
+		Status: lockStatusSucceeded,
+	})
+	if err == nil {
+		t.Fatal("insert a duplicate lock of default branch, want error")
+	}
+
+	// migrating again changes nothing.
+	if v2, err := cli.Migrate(); err != nil || v2 != v {
+		t.Fatalf("migrate again: version = %d, err = %v", v2, err)
+	}
+}
+
+func TestInsertLockOfDefaultBranch(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	if _, err := cli.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	mapper := NewSyncLockMapper(cli)
+
+	do := synclockimpl.RepoSyncLockDO{Owner: "owner", RepoId: "1", Status: "pending"}
+	if _, err := mapper.Insert(&do); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	var n int64
+	err := cli.lockTable().Where(fieldRef + " IS NULL").Count(&n).Error
+	if err != nil || n != 0 {
+		t.Fatalf("locks with NULL ref = %d, err = %v", n, err)
+	}
+
+	if _, err := mapper.Insert(&do); err == nil {
+		t.Fatal("insert a duplicate lock, want error")
+	}
+}
+
+func TestMigrationsAreFrozen(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	cases := []struct {
+		absent  []string
+		present []string
+	}{
+		{absent: []string{fieldFailures, fieldLastError, fieldFence}, present: []string{fieldExpiry}},
+		{absent: []string{fieldFailures, fieldLastError, fieldFence}},
+		{absent: []string{fieldFence}, present: []string{fieldFailures, fieldLastError}},
+		{present: []string{fieldFence}},
+	}
+
+	m := cli.lockTable().Migrator()
+
+	for i, c := range cases {
+		if err := migrations[i].up(cli); err != nil {
+			t.Fatalf("migrate to version %d: %v", migrations[i].version, err)
+		}
+
+		for _, col := range c.absent {
+			if m.HasColumn(&RepoSyncLock{}, col) {
+				t.Fatalf("version %d adds column %s", migrations[i].version, col)
+			}
+		}
+
+		for _, col := range c.present {
+			if !m.HasColumn(&RepoSyncLock{}, col) {
+				t.Fatalf("version %d misses column %s", migrations[i].version, col)
+			}
+		}
+	}
+}
+
+func TestMigrationsAreIdempotent(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	// the instances migrating at the same time may apply the same version.
+	for i := range migrations {
+		for j := 0; j < 2; j++ {
+			if err := migrations[i].up(cli); err != nil {
+				t.Fatalf("apply version %d again: %v", migrations[i].version, err)
+			}
+		}
+	}
+}
+
+func TestMigrationsCoverModels(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	if _, err := cli.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	models := []struct {
+		tx    *gorm.DB
+		model interface{}
+	}{
+		{cli.lockTable(), &RepoSyncLock{}},
+		{cli.taskTable(), &SyncTask{}},
+		{cli.historyTable(), &SyncHistory{}},
+	}
+
+	for _, v := range models {
+		if err := v.tx.Statement.Parse(v.model); err != nil {
+			t.Fatalf("parse model: %v", err)
+		}
+
+		m := v.tx.Migrator()
+
+		for _, f := range v.tx.Statement.Schema.Fields {
+			if !m.HasColumn(v.model, f.DBName) {
+				t.Fatalf("column %s of %s is not added by any migration", f.DBName, v.tx.Statement.Table)
+			}
+		}
+	}
+}
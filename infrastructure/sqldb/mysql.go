@@ -0,0 +1,25 @@
+package sqldb
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	gormmysql "gorm.io/driver/mysql"
+)
+
+const mysqlErrDupEntry = 1062
+
+func NewMysql(cfg *Config) (*Client, error) {
+	return newClient(gormmysql.New(gormmysql.Config{
+		DSN:                       cfg.Conn,
+		DontSupportRenameIndex:    true,
+		DontSupportRenameColumn:   true,
+		SkipInitializeWithVersion: false,
+	}), cfg, isMysqlDuplicate)
+}
+
+func isMysqlDuplicate(err error) bool {
+	var v *mysql.MySQLError
+
+	return errors.As(err, &v) && v.Number == mysqlErrDupEntry
+}
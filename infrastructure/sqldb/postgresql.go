@@ -0,0 +1,23 @@
+package sqldb
+
+import (
+	"errors"
+
+	"gorm.io/driver/postgres"
+)
+
+const postgresqlUniqueViolation = "23505"
+
+// NewPostgreSQL returns the client of PostgreSQL whose Conn is like
+// "host=localhost user=sync password=xxx dbname=sync port=5432".
+func NewPostgreSQL(cfg *Config) (*Client, error) {
+	return newClient(postgres.Open(cfg.Conn), cfg, isPostgreSQLDuplicate)
+}
+
+// isPostgreSQLDuplicate checks the SQLSTATE of error which is implemented
+// by the error of pgx, so that the driver is not imported directly.
+func isPostgreSQLDuplicate(err error) bool {
+	var v interface{ SQLState() string }
+
+	return errors.As(err, &v) && v.SQLState() == postgresqlUniqueViolation
+}
@@ -0,0 +1,58 @@
+package sqldb
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Client is the database which saves the sync locks, tasks and histories.
+// It works with any database supported by gorm.
+type Client struct {
+	db  *gorm.DB
+	cfg Config
+
+	// isDuplicate checks whether the error is the violation of unique key,
+	// and it depends on the database.
+	isDuplicate func(error) bool
+}
+
+func newClient(
+	dialector gorm.Dialector, cfg *Config, isDuplicate func(error) bool,
+) (*Client, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+
+	return &Client{
+		db:          db,
+		cfg:         *cfg,
+		isDuplicate: isDuplicate,
+	}, nil
+}
+
+func (c *Client) lockTable() *gorm.DB {
+	return c.db.Table(c.cfg.TableName)
+}
+
+func (c *Client) taskTable() *gorm.DB {
+	return c.db.Table(c.cfg.TaskTableName)
+}
+
+func (c *Client) historyTable() *gorm.DB {
+	return c.db.Table(c.cfg.HistoryTableName)
+}
+
+func (c *Client) schemaTable() *gorm.DB {
+	return c.db.Table(c.cfg.SchemaTableName)
+}
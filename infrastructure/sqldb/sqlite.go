@@ -0,0 +1,33 @@
+package sqldb
+
+import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
+)
+
+// NewSQLite returns the client of SQLite whose Conn is the path of
+// database file. It is implemented by pure go and doesn't need cgo.
+func NewSQLite(cfg *Config) (*Client, error) {
+	c, err := newClient(sqlite.Open(cfg.Conn), cfg, isSQLiteDuplicate)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer, so the concurrent writes would fail
+	// with "database is locked".
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+
+	return c, nil
+}
+
+// isSQLiteDuplicate checks the message of error, because the code of error
+// is only exposed by the underlying driver.
+func isSQLiteDuplicate(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
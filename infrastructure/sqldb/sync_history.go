@@ -0,0 +1,124 @@
+package sqldb
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synchistoryimpl"
+)
+
+func NewSyncHistoryMapper(cli *Client) synchistoryimpl.SyncHistoryMapper {
+	return syncHistory{cli: cli}
+}
+
+type syncHistory struct {
+	cli *Client
+}
+
+func (rs syncHistory) Insert(do *synchistoryimpl.SyncHistoryDO) error {
+	table := rs.toSyncHistoryTable(do)
+
+	return rs.cli.historyTable().Create(&table).Error
+}
+
+func (rs syncHistory) List(opt *synchistory.ListOption) (
+	[]synchistoryimpl.SyncHistoryDO, int, error,
+) {
+	cond := map[string]interface{}{}
+	if opt.Owner != "" {
+		cond[fieldOwner] = opt.Owner
+	}
+	if opt.RepoId != "" {
+		cond[fieldRepoId] = opt.RepoId
+	}
+	if opt.Ref != nil {
+		cond[fieldRef] = *opt.Ref
+	}
+
+	var total int64
+	if err := rs.cli.historyTable().Where(cond).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var data []SyncHistory
+
+	err := rs.cli.historyTable().Where(cond).
+		Order(fieldStartTime + " desc").Offset(opt.Offset).Limit(opt.Limit).
+		Find(&data).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := make([]synchistoryimpl.SyncHistoryDO, len(data))
+	for i := range data {
+		r[i] = rs.toSyncHistoryDo(&data[i])
+	}
+
+	return r, int(total), nil
+}
+
+func (rs syncHistory) toSyncHistoryTable(do *synchistoryimpl.SyncHistoryDO) SyncHistory {
+	return SyncHistory{
+		Owner:      do.Owner,
+		RepoId:     do.RepoId,
+		Ref:        do.Ref,
+		StartTime:  do.StartTime,
+		EndTime:    do.EndTime,
+		FromCommit: do.FromCommit,
+		ToCommit:   do.ToCommit,
+		Added:      do.Added,
+		Modified:   do.Modified,
+		Deleted:    do.Deleted,
+		LFSCopied:  do.LFSCopied,
+		Bytes:      do.Bytes,
+		Outcome:    do.Outcome,
+		Error:      do.Error,
+		Mismatches: encodeMismatches(do.Mismatches),
+	}
+}
+
+func (rs syncHistory) toSyncHistoryDo(data *SyncHistory) synchistoryimpl.SyncHistoryDO {
+	return synchistoryimpl.SyncHistoryDO{
+		Id:         strconv.Itoa(data.Id),
+		Owner:      data.Owner,
+		RepoId:     data.RepoId,
+		Ref:        data.Ref,
+		StartTime:  data.StartTime,
+		EndTime:    data.EndTime,
+		FromCommit: data.FromCommit,
+		ToCommit:   data.ToCommit,
+		Added:      data.Added,
+		Modified:   data.Modified,
+		Deleted:    data.Deleted,
+		LFSCopied:  data.LFSCopied,
+		Bytes:      data.Bytes,
+		Outcome:    data.Outcome,
+		Error:      data.Error,
+		Mismatches: decodeMismatches(data.Mismatches),
+	}
+}
+
+func encodeMismatches(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(v)
+
+	return string(b)
+}
+
+func decodeMismatches(v string) []string {
+	if v == "" {
+		return nil
+	}
+
+	var r []string
+	if err := json.Unmarshal([]byte(v), &r); err != nil {
+		// it is only for showing, so keep the broken value as is.
+		return []string{v}
+	}
+
+	return r
+}
@@ -0,0 +1,50 @@
+package sqldb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synchistoryimpl"
+)
+
+func TestSyncHistoryMismatches(t *testing.T) {
+	cli := newTestSQLite(t)
+
+	if _, err := cli.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	mapper := NewSyncHistoryMapper(cli)
+
+	items := []synchistoryimpl.SyncHistoryDO{
+		{
+			Owner: "owner", RepoId: "1", StartTime: 1, Outcome: "failed",
+			Mismatches: []string{"a: missing", "b\nc: not deleted"},
+		},
+		{Owner: "owner", RepoId: "1", Ref: "refs/tags/v1", StartTime: 2, Outcome: "succeeded"},
+	}
+
+	for i := range items {
+		if err := mapper.Insert(&items[i]); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	ref := ""
+	v, total, err := mapper.List(&synchistory.ListOption{
+		Owner: "owner", RepoId: "1", Ref: &ref, Limit: 10,
+	})
+	if err != nil || total != 1 || len(v) != 1 {
+		t.Fatalf("list: %+v, %d, %v", v, total, err)
+	}
+
+	if !reflect.DeepEqual(v[0].Mismatches, items[0].Mismatches) {
+		t.Fatalf("mismatches = %q, want %q", v[0].Mismatches, items[0].Mismatches)
+	}
+
+	v, _, err = mapper.List(&synchistory.ListOption{Owner: "owner", RepoId: "1", Limit: 10})
+	if err != nil || len(v) != 2 || v[0].Mismatches != nil {
+		t.Fatalf("list all: %+v, %v", v, err)
+	}
+}
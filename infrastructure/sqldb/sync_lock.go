@@ -0,0 +1,196 @@
+package sqldb
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synclockimpl"
+)
+
+func NewSyncLockMapper(cli *Client) synclockimpl.SyncLockMapper {
+	return syncLock{cli: cli}
+}
+
+type syncLock struct {
+	cli *Client
+}
+
+func (rs syncLock) Insert(do *synclockimpl.RepoSyncLockDO) (string, error) {
+	table := rs.toSyncLockTable(do)
+
+	r := rs.cli.lockTable().Create(&table)
+	if r.Error != nil {
+		if rs.cli.isDuplicate(r.Error) {
+			return "", synclockimpl.NewErrorDuplicateCreating(r.Error)
+		}
+
+		return "", r.Error
+	}
+
+	if r.RowsAffected == 0 {
+		return "", synclockimpl.NewErrorDuplicateCreating(
+			errors.New("duplecate creating"),
+		)
+	}
+
+	return strconv.Itoa(table.Id), nil
+}
+
+func (rs syncLock) Get(owner, repoId, ref string) (do synclockimpl.RepoSyncLockDO, err error) {
+	cond := refCond(owner, repoId, ref)
+
+	data := new(RepoSyncLock)
+
+	err = rs.cli.lockTable().Where(cond).First(data).Error
+
+	if err == nil {
+		do = rs.toSyncLockDo(data)
+	} else {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = synclockimpl.NewErrorDataNotExists(err)
+		}
+	}
+
+	return
+}
+
+func (rs syncLock) Update(do *synclockimpl.RepoSyncLockDO) error {
+	cond := refCond(do.Owner, do.RepoId, do.Ref)
+	cond[fieldVersion] = do.Version
+
+	values := map[string]interface{}{
+		fieldVersion:    gorm.Expr(fieldVersion+" + ?", 1),
+		fieldLastCommit: do.LastCommit,
+		fieldRepoType:   do.RepoType,
+		fieldFailures:   do.Failures,
+		fieldLastError:  do.LastError,
+		fieldStatus:     do.Status,
+		fieldHolder:     do.Holder,
+		fieldExpiry:     do.Expiry,
+	}
+
+	tx := rs.cli.lockTable().Where(cond)
+
+	// the fence only increases, so the one whose fence is older than the
+	// saved one can't overwrite the result of the new holder.
+	if do.Fence != 0 {
+		tx = tx.Where(fieldFence+" <= ?", do.Fence)
+		values[fieldFence] = do.Fence
+	}
+
+	tx = tx.Updates(values)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return synclockimpl.NewErrorConcurrentUpdating(
+			errors.New("no matched record"),
+		)
+	}
+
+	return nil
+}
+
+func (rs syncLock) GetByRepo(repoId string) ([]synclockimpl.RepoSyncLockDO, error) {
+	var data []RepoSyncLock
+
+	err := rs.cli.lockTable().
+		Where(map[string]interface{}{fieldRepoId: repoId}).
+		Find(&data).Error
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]synclockimpl.RepoSyncLockDO, len(data))
+	for i := range data {
+		r[i] = rs.toSyncLockDo(&data[i])
+	}
+
+	return r, nil
+}
+
+func (rs syncLock) List(opt *synclock.ListOption) ([]synclockimpl.RepoSyncLockDO, error) {
+	cond := map[string]interface{}{}
+	if opt.Owner != "" {
+		cond[fieldOwner] = opt.Owner
+	}
+	if opt.Status != "" {
+		cond[fieldStatus] = opt.Status
+	}
+
+	tx := rs.cli.lockTable().Where(cond).Order(fieldId).Offset(opt.Offset)
+	if opt.Limit > 0 {
+		tx = tx.Limit(opt.Limit)
+	}
+
+	var data []RepoSyncLock
+
+	err := tx.Find(&data).Error
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]synclockimpl.RepoSyncLockDO, len(data))
+	for i := range data {
+		r[i] = rs.toSyncLockDo(&data[i])
+	}
+
+	return r, nil
+}
+
+func (rs syncLock) Delete(do *synclockimpl.RepoSyncLockDO) error {
+	cond := refCond(do.Owner, do.RepoId, do.Ref)
+	cond[fieldVersion] = do.Version
+
+	tx := rs.cli.lockTable().Where(cond).Delete(&RepoSyncLock{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return synclockimpl.NewErrorConcurrentUpdating(
+			errors.New("no matched record"),
+		)
+	}
+
+	return nil
+}
+
+func (rs syncLock) toSyncLockTable(do *synclockimpl.RepoSyncLockDO) RepoSyncLock {
+	return RepoSyncLock{
+		Owner:      do.Owner,
+		RepoId:     do.RepoId,
+		Ref:        do.Ref,
+		RepoType:   do.RepoType,
+		Status:     do.Status,
+		Version:    do.Version,
+		LastCommit: do.LastCommit,
+		Failures:   do.Failures,
+		LastError:  do.LastError,
+		Holder:     do.Holder,
+		Expiry:     do.Expiry,
+		Fence:      do.Fence,
+	}
+}
+
+func (rs syncLock) toSyncLockDo(data *RepoSyncLock) synclockimpl.RepoSyncLockDO {
+	return synclockimpl.RepoSyncLockDO{
+		Id:         strconv.Itoa(data.Id),
+		Owner:      data.Owner,
+		RepoId:     data.RepoId,
+		Ref:        data.Ref,
+		RepoType:   data.RepoType,
+		Status:     data.Status,
+		Version:    data.Version,
+		LastCommit: data.LastCommit,
+		Failures:   data.Failures,
+		LastError:  data.LastError,
+		Holder:     data.Holder,
+		Expiry:     data.Expiry,
+		Fence:      data.Fence,
+	}
+}
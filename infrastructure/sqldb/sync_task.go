@@ -0,0 +1,156 @@
+package sqldb
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synctaskimpl"
+)
+
+func NewSyncTaskMapper(cli *Client) synctaskimpl.SyncTaskMapper {
+	return syncTask{cli: cli}
+}
+
+type syncTask struct {
+	cli *Client
+}
+
+func (rs syncTask) Insert(do *synctaskimpl.SyncTaskDO) (string, error) {
+	table := rs.toSyncTaskTable(do)
+
+	r := rs.cli.taskTable().Create(&table)
+	if r.Error != nil {
+		if rs.cli.isDuplicate(r.Error) {
+			return "", synctaskimpl.NewErrorDuplicateCreating(r.Error)
+		}
+
+		return "", r.Error
+	}
+
+	if r.RowsAffected == 0 {
+		return "", synctaskimpl.NewErrorDuplicateCreating(
+			errors.New("duplecate creating"),
+		)
+	}
+
+	return strconv.Itoa(table.Id), nil
+}
+
+func (rs syncTask) Get(owner, repoId, ref string) (do synctaskimpl.SyncTaskDO, err error) {
+	cond := refCond(owner, repoId, ref)
+
+	data := new(SyncTask)
+
+	err = rs.cli.taskTable().Where(cond).First(data).Error
+
+	if err == nil {
+		do = rs.toSyncTaskDo(data)
+	} else {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = synctaskimpl.NewErrorDataNotExists(err)
+		}
+	}
+
+	return
+}
+
+func (rs syncTask) GetDue(now int64, limit int) ([]synctaskimpl.SyncTaskDO, error) {
+	var data []SyncTask
+
+	err := rs.cli.taskTable().
+		Where(fieldStatus+" = ? AND "+fieldNextRetry+" <= ?", syncTaskStatusPending, now).
+		Order(fieldNextRetry).Limit(limit).Find(&data).Error
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]synctaskimpl.SyncTaskDO, len(data))
+	for i := range data {
+		r[i] = rs.toSyncTaskDo(&data[i])
+	}
+
+	return r, nil
+}
+
+func (rs syncTask) Update(do *synctaskimpl.SyncTaskDO) error {
+	cond := refCond(do.Owner, do.RepoId, do.Ref)
+	cond[fieldVersion] = do.Version
+
+	tx := rs.cli.taskTable().Where(cond).Updates(
+		map[string]interface{}{
+			fieldVersion:   gorm.Expr(fieldVersion+" + ?", 1),
+			fieldRepoName:  do.RepoName,
+			fieldAction:    do.Action,
+			fieldStatus:    do.Status,
+			fieldAttempts:  do.Attempts,
+			fieldLastError: do.LastError,
+			fieldNextRetry: do.NextRetry,
+		},
+	)
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return synctaskimpl.NewErrorConcurrentUpdating(
+			errors.New("no matched record"),
+		)
+	}
+
+	return nil
+}
+
+func (rs syncTask) Delete(do *synctaskimpl.SyncTaskDO) error {
+	cond := refCond(do.Owner, do.RepoId, do.Ref)
+	cond[fieldVersion] = do.Version
+
+	tx := rs.cli.taskTable().Where(cond).Delete(&SyncTask{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return synctaskimpl.NewErrorConcurrentUpdating(
+			errors.New("no matched record"),
+		)
+	}
+
+	return nil
+}
+
+func (rs syncTask) DeleteByRepo(repoId string) error {
+	return rs.cli.taskTable().Where(fieldRepoId+" = ?", repoId).Delete(&SyncTask{}).Error
+}
+
+func (rs syncTask) toSyncTaskTable(do *synctaskimpl.SyncTaskDO) SyncTask {
+	return SyncTask{
+		Owner:     do.Owner,
+		RepoId:    do.RepoId,
+		RepoName:  do.RepoName,
+		Ref:       do.Ref,
+		Action:    do.Action,
+		Status:    do.Status,
+		Attempts:  do.Attempts,
+		LastError: do.LastError,
+		NextRetry: do.NextRetry,
+		Version:   do.Version,
+	}
+}
+
+func (rs syncTask) toSyncTaskDo(data *SyncTask) synctaskimpl.SyncTaskDO {
+	return synctaskimpl.SyncTaskDO{
+		Id:        strconv.Itoa(data.Id),
+		Owner:     data.Owner,
+		RepoId:    data.RepoId,
+		RepoName:  data.RepoName,
+		Ref:       data.Ref,
+		Action:    data.Action,
+		Status:    data.Status,
+		Attempts:  data.Attempts,
+		LastError: data.LastError,
+		NextRetry: data.NextRetry,
+		Version:   data.Version,
+	}
+}
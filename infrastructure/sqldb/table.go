@@ -0,0 +1,94 @@
+package sqldb
+
+const (
+	fieldId         = "id"
+	fieldOwner      = "owner"
+	fieldRepoId     = "repo_id"
+	fieldRepoType   = "repo_type"
+	fieldRef        = "ref"
+	fieldStatus     = "status"
+	fieldVersion    = "version"
+	fieldLastCommit = "last_commit"
+	fieldHolder     = "holder"
+	fieldExpiry     = "expiry"
+	fieldFence      = "fence"
+	fieldRepoName   = "repo_name"
+	fieldAttempts   = "attempts"
+	fieldLastError  = "last_error"
+	fieldFailures   = "failures"
+	fieldNextRetry  = "next_retry"
+	fieldAction     = "action"
+	fieldStartTime  = "start_time"
+
+	syncTaskStatusPending = "pending"
+
+	lockStatusDone      = "done"
+	lockStatusSucceeded = "succeeded"
+)
+
+type RepoSyncLock struct {
+	Id         int    `json:"-"            gorm:"column:id;primaryKey"`
+	Owner      string `json:"-"            gorm:"column:owner;size:100"`
+	RepoId     string `json:"-"            gorm:"column:repo_id;size:64"`
+	Ref        string `json:"ref"          gorm:"column:ref;size:255;not null;default:''"`
+	RepoType   string `json:"repo_type"    gorm:"column:repo_type;size:32"`
+	Status     string `json:"status"       gorm:"column:status;size:32"`
+	Version    int    `json:"-"            gorm:"column:version"`
+	LastCommit string `json:"last_commit"  gorm:"column:last_commit;size:64"`
+	Failures   int    `json:"failures"     gorm:"column:failures"`
+	LastError  string `json:"last_error"   gorm:"column:last_error"`
+	Holder     string `json:"holder"       gorm:"column:holder;size:255"`
+	Expiry     int64  `json:"expiry"       gorm:"column:expiry"`
+	Fence      int64  `json:"fence"        gorm:"column:fence;not null;default:0"`
+}
+
+type SyncTask struct {
+	Id        int    `json:"-"            gorm:"column:id;primaryKey"`
+	Owner     string `json:"-"            gorm:"column:owner;size:100"`
+	RepoId    string `json:"-"            gorm:"column:repo_id;size:64"`
+	RepoName  string `json:"repo_name"    gorm:"column:repo_name;size:255"`
+	Ref       string `json:"ref"          gorm:"column:ref;size:255;not null;default:''"`
+	Action    string `json:"action"       gorm:"column:action;size:32;not null;default:''"`
+	Status    string `json:"status"       gorm:"column:status;size:32"`
+	Attempts  int    `json:"attempts"     gorm:"column:attempts"`
+	LastError string `json:"last_error"   gorm:"column:last_error"`
+	NextRetry int64  `json:"next_retry"   gorm:"column:next_retry"`
+	Version   int    `json:"-"            gorm:"column:version"`
+}
+
+type SyncHistory struct {
+	Id         int    `json:"-"            gorm:"column:id;primaryKey"`
+	Owner      string `json:"-"            gorm:"column:owner;size:100"`
+	RepoId     string `json:"-"            gorm:"column:repo_id;size:64"`
+	Ref        string `json:"ref"          gorm:"column:ref;size:255;not null;default:''"`
+	StartTime  int64  `json:"start_time"   gorm:"column:start_time"`
+	EndTime    int64  `json:"end_time"     gorm:"column:end_time"`
+	FromCommit string `json:"from_commit"  gorm:"column:from_commit;size:64"`
+	ToCommit   string `json:"to_commit"    gorm:"column:to_commit;size:64"`
+	Added      int    `json:"added"        gorm:"column:added"`
+	Modified   int    `json:"modified"     gorm:"column:modified"`
+	Deleted    int    `json:"deleted"      gorm:"column:deleted"`
+	LFSCopied  int    `json:"lfs_copied"   gorm:"column:lfs_copied"`
+	Bytes      int64  `json:"bytes"        gorm:"column:bytes"`
+	Outcome    string `json:"outcome"      gorm:"column:outcome;size:32"`
+	Error      string `json:"error"        gorm:"column:error"`
+	// Mismatches is the json array of mismatches.
+	Mismatches string `json:"mismatches"   gorm:"column:mismatches"`
+}
+
+// SchemaVersion is a migration applied to the database.
+type SchemaVersion struct {
+	Version     int    `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Description string `gorm:"column:description;size:255"`
+	AppliedAt   int64  `gorm:"column:applied_at"`
+}
+
+// refCond is the condition to find the record of ref. The zero value of
+// struct is ignored by gorm, so map is used because ref may be empty.
+func refCond(owner, repoId, ref string) map[string]interface{} {
+	return map[string]interface{}{
+		fieldOwner:  owner,
+		fieldRepoId: repoId,
+		fieldRef:    ref,
+	}
+}
@@ -0,0 +1,106 @@
+package synchistoryimpl
+
+import (
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+)
+
+type SyncHistoryMapper interface {
+	Insert(*SyncHistoryDO) error
+	List(*synchistory.ListOption) ([]SyncHistoryDO, int, error)
+}
+
+func NewSyncHistory(mapper SyncHistoryMapper) synchistory.SyncHistory {
+	return syncHistory{mapper}
+}
+
+type syncHistory struct {
+	mapper SyncHistoryMapper
+}
+
+func (impl syncHistory) Add(p *domain.SyncHistory) error {
+	do := impl.toSyncHistoryDO(p)
+
+	return impl.mapper.Insert(&do)
+}
+
+func (impl syncHistory) List(opt *synchistory.ListOption) ([]domain.SyncHistory, int, error) {
+	v, total, err := impl.mapper.List(opt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := make([]domain.SyncHistory, len(v))
+	for i := range v {
+		if err := v[i].toSyncHistory(&r[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return r, total, nil
+}
+
+func (impl syncHistory) toSyncHistoryDO(p *domain.SyncHistory) SyncHistoryDO {
+	return SyncHistoryDO{
+		Id:         p.Id,
+		Owner:      p.Owner.Account(),
+		RepoId:     p.RepoId,
+		Ref:        p.Ref,
+		StartTime:  p.StartTime,
+		EndTime:    p.EndTime,
+		FromCommit: p.FromCommit,
+		ToCommit:   p.ToCommit,
+		Added:      p.Added,
+		Modified:   p.Modified,
+		Deleted:    p.Deleted,
+		LFSCopied:  p.LFSCopied,
+		Bytes:      p.Bytes,
+		Outcome:    p.Outcome.SyncOutcome(),
+		Error:      p.Error,
+		Mismatches: p.Mismatches,
+	}
+}
+
+type SyncHistoryDO struct {
+	Id         string
+	Owner      string
+	RepoId     string
+	Ref        string
+	StartTime  int64
+	EndTime    int64
+	FromCommit string
+	ToCommit   string
+	Added      int
+	Modified   int
+	Deleted    int
+	LFSCopied  int
+	Bytes      int64
+	Outcome    string
+	Error      string
+	Mismatches []string
+}
+
+func (do *SyncHistoryDO) toSyncHistory(r *domain.SyncHistory) (err error) {
+	r.Id = do.Id
+	r.RepoId = do.RepoId
+	r.Ref = do.Ref
+	r.StartTime = do.StartTime
+	r.EndTime = do.EndTime
+	r.FromCommit = do.FromCommit
+	r.ToCommit = do.ToCommit
+	r.Added = do.Added
+	r.Modified = do.Modified
+	r.Deleted = do.Deleted
+	r.LFSCopied = do.LFSCopied
+	r.Bytes = do.Bytes
+	r.Error = do.Error
+	r.Mismatches = do.Mismatches
+
+	if r.Owner, err = domain.NewAccount(do.Owner); err != nil {
+		return
+	}
+
+	r.Outcome, err = domain.NewSyncOutcome(do.Outcome)
+
+	return
+}
@@ -8,7 +8,10 @@ import (
 type SyncLockMapper interface {
 	Insert(*RepoSyncLockDO) (string, error)
 	Update(*RepoSyncLockDO) error
-	Get(string, string) (RepoSyncLockDO, error)
+	Delete(*RepoSyncLockDO) error
+	Get(string, string, string) (RepoSyncLockDO, error)
+	GetByRepo(string) ([]RepoSyncLockDO, error)
+	List(*synclock.ListOption) ([]RepoSyncLockDO, error)
 }
 
 func NewRepoSyncLock(mapper SyncLockMapper) synclock.RepoSyncLock {
@@ -44,10 +47,10 @@ func (impl syncLock) Save(p *domain.RepoSyncLock) (r domain.RepoSyncLock, err er
 	return
 }
 
-func (impl syncLock) Find(owner domain.Account, repoId string) (
+func (impl syncLock) Find(owner domain.Account, repoId, ref string) (
 	r domain.RepoSyncLock, err error,
 ) {
-	v, err := impl.mapper.Get(owner.Account(), repoId)
+	v, err := impl.mapper.Get(owner.Account(), repoId, ref)
 	if err != nil {
 		err = convertError(err)
 	} else {
@@ -57,32 +60,91 @@ func (impl syncLock) Find(owner domain.Account, repoId string) (
 	return
 }
 
+func (impl syncLock) FindByRepo(repoId string) ([]domain.RepoSyncLock, error) {
+	v, err := impl.mapper.GetByRepo(repoId)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return toSyncLocks(v)
+}
+
+func (impl syncLock) List(opt *synclock.ListOption) ([]domain.RepoSyncLock, error) {
+	v, err := impl.mapper.List(opt)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	return toSyncLocks(v)
+}
+
+func toSyncLocks(v []RepoSyncLockDO) ([]domain.RepoSyncLock, error) {
+	r := make([]domain.RepoSyncLock, len(v))
+	for i := range v {
+		if err := v[i].toSyncLock(&r[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (impl syncLock) Remove(p *domain.RepoSyncLock) error {
+	do := impl.toRepoSyncLockDO(p)
+
+	return convertError(impl.mapper.Delete(&do))
+}
+
 func (impl syncLock) toRepoSyncLockDO(p *domain.RepoSyncLock) RepoSyncLockDO {
-	return RepoSyncLockDO{
+	do := RepoSyncLockDO{
 		Id:         p.Id,
 		Owner:      p.Owner.Account(),
 		RepoId:     p.RepoId,
+		Ref:        p.Ref,
 		LastCommit: p.LastCommit,
+		Failures:   p.Failures,
+		LastError:  p.LastError,
 		Status:     p.Status.RepoSyncStatus(),
 		Version:    p.Version,
+		Holder:     p.Holder,
+		Expiry:     p.Expiry,
+		Fence:      p.Fence,
 	}
+
+	if p.RepoType != nil {
+		do.RepoType = p.RepoType.ResourceType()
+	}
+
+	return do
 }
 
 type RepoSyncLockDO struct {
 	Id         string
 	Owner      string
 	RepoId     string
+	Ref        string
 	Status     string
 	RepoType   string
 	LastCommit string
+	Failures   int
+	LastError  string
 	Version    int
+	Holder     string
+	Expiry     int64
+	Fence      int64
 }
 
 func (do *RepoSyncLockDO) toSyncLock(r *domain.RepoSyncLock) (err error) {
 	r.Id = do.Id
 	r.RepoId = do.RepoId
+	r.Ref = do.Ref
 	r.Version = do.Version
 	r.LastCommit = do.LastCommit
+	r.Failures = do.Failures
+	r.LastError = do.LastError
+	r.Holder = do.Holder
+	r.Expiry = do.Expiry
+	r.Fence = do.Fence
 
 	if r.Owner, err = domain.NewAccount(do.Owner); err != nil {
 		return
@@ -92,5 +154,9 @@ func (do *RepoSyncLockDO) toSyncLock(r *domain.RepoSyncLock) (err error) {
 		return
 	}
 
+	if r.RepoType, err = domain.NewResourceType(do.RepoType); err != nil {
+		return
+	}
+
 	return
 }
@@ -0,0 +1,39 @@
+package synctaskimpl
+
+import "github.com/opensourceways/robot-gitlab-sync-repo/domain/synctask"
+
+type errorDuplicateCreating struct {
+	error
+}
+
+func NewErrorDuplicateCreating(err error) errorDuplicateCreating {
+	return errorDuplicateCreating{err}
+}
+
+type errorDataNotExists struct {
+	error
+}
+
+func NewErrorDataNotExists(err error) errorDataNotExists {
+	return errorDataNotExists{err}
+}
+
+type errorConcurrentUpdating struct {
+	error
+}
+
+func NewErrorConcurrentUpdating(err error) errorConcurrentUpdating {
+	return errorConcurrentUpdating{err}
+}
+
+func convertError(err error) (out error) {
+	switch err.(type) {
+	case errorDataNotExists:
+		out = synctask.NewErrorTaskNotExists(err)
+
+	default:
+		out = err
+	}
+
+	return
+}
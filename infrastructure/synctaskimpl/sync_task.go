@@ -0,0 +1,145 @@
+package synctaskimpl
+
+import (
+	"errors"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synctask"
+)
+
+type SyncTaskMapper interface {
+	Insert(*SyncTaskDO) (string, error)
+	Update(*SyncTaskDO) error
+	Delete(*SyncTaskDO) error
+	Get(string, string, string) (SyncTaskDO, error)
+	GetDue(int64, int) ([]SyncTaskDO, error)
+	DeleteByRepo(string) error
+}
+
+func NewSyncTask(mapper SyncTaskMapper) synctask.SyncTask {
+	return syncTask{mapper}
+}
+
+type syncTask struct {
+	mapper SyncTaskMapper
+}
+
+func (impl syncTask) Save(p *domain.SyncTask) (r domain.SyncTask, err error) {
+	do := impl.toSyncTaskDO(p)
+
+	if p.Id != "" {
+		if err = impl.mapper.Update(&do); err != nil {
+			err = convertError(err)
+		} else {
+			r = *p
+			r.Version += 1
+		}
+
+		return
+	}
+
+	v, err := impl.mapper.Insert(&do)
+	if err != nil {
+		err = convertError(err)
+	} else {
+		r = *p
+		r.Id = v
+	}
+
+	return
+}
+
+func (impl syncTask) Remove(p *domain.SyncTask) error {
+	do := impl.toSyncTaskDO(p)
+
+	return convertError(impl.mapper.Delete(&do))
+}
+
+func (impl syncTask) RemoveByRepo(repoId string) error {
+	return convertError(impl.mapper.DeleteByRepo(repoId))
+}
+
+func (impl syncTask) Find(owner domain.Account, repoId, ref string) (
+	r domain.SyncTask, err error,
+) {
+	v, err := impl.mapper.Get(owner.Account(), repoId, ref)
+	if err != nil {
+		err = convertError(err)
+	} else {
+		err = v.toSyncTask(&r)
+	}
+
+	return
+}
+
+func (impl syncTask) FindDue(now int64, limit int) ([]domain.SyncTask, error) {
+	v, err := impl.mapper.GetDue(now, limit)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	r := make([]domain.SyncTask, len(v))
+	for i := range v {
+		if err := v[i].toSyncTask(&r[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (impl syncTask) toSyncTaskDO(p *domain.SyncTask) SyncTaskDO {
+	return SyncTaskDO{
+		Id:        p.Id,
+		Owner:     p.Owner.Account(),
+		RepoId:    p.RepoId,
+		RepoName:  p.RepoName,
+		Ref:       p.Ref,
+		Action:    p.Action,
+		Status:    p.Status.SyncTaskStatus(),
+		Attempts:  p.Attempts,
+		LastError: p.LastError,
+		NextRetry: p.NextRetry,
+		Version:   p.Version,
+	}
+}
+
+type SyncTaskDO struct {
+	Id        string
+	Owner     string
+	RepoId    string
+	RepoName  string
+	Ref       string
+	Action    string
+	Status    string
+	Attempts  int
+	LastError string
+	NextRetry int64
+	Version   int
+}
+
+func (do *SyncTaskDO) toSyncTask(r *domain.SyncTask) (err error) {
+	r.Id = do.Id
+	r.RepoId = do.RepoId
+	r.RepoName = do.RepoName
+	r.Ref = do.Ref
+	r.Action = do.Action
+	r.Attempts = do.Attempts
+	r.LastError = do.LastError
+	r.NextRetry = do.NextRetry
+	r.Version = do.Version
+
+	if r.Owner, err = domain.NewAccount(do.Owner); err != nil {
+		return
+	}
+
+	if r.Status, err = domain.NewSyncTaskStatus(do.Status); err != nil {
+		return
+	}
+
+	if !domain.IsValidSyncTaskAction(do.Action) {
+		err = errors.New("invalid sync task action")
+	}
+
+	return
+}
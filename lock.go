@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/redislockimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/sqldb"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synclockimpl"
+)
+
+const (
+	lockDatabase = "database"
+	lockRedis    = "redis"
+)
+
+type lockConfig struct {
+	// Lock is where the lock of running sync is kept, database or redis.
+	// Default is database. The rest of lock, like the last synced commit,
+	// is always saved in the database.
+	Lock string `json:"lock"`
+
+	// Redis is required if Lock is redis.
+	Redis *redislockimpl.Config `json:"redis"`
+}
+
+func (cfg *lockConfig) SetDefault() {
+	if cfg.Lock == "" {
+		cfg.Lock = lockDatabase
+	}
+
+	if cfg.Redis != nil {
+		cfg.Redis.SetDefault()
+	}
+}
+
+func (cfg *lockConfig) Validate() error {
+	switch cfg.Lock {
+	case lockDatabase:
+		return nil
+
+	case lockRedis:
+		if cfg.Redis == nil {
+			return errors.New("missing the config of redis")
+		}
+
+		return nil
+
+	default:
+		return errors.New("unknown lock")
+	}
+}
+
+func newLock(cfg *lockConfig, db *sqldb.Client) (synclock.RepoSyncLock, error) {
+	durable := synclockimpl.NewRepoSyncLock(sqldb.NewSyncLockMapper(db))
+
+	if cfg.Lock != lockRedis {
+		return durable, nil
+	}
+
+	cli, err := redislockimpl.NewClient(cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	return redislockimpl.NewRepoSyncLock(durable, cli, cfg.Redis), nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"net/http"
 	"os"
 
 	"github.com/opensourceways/community-robot-lib/logrusutil"
@@ -9,13 +10,19 @@ import (
 	framework "github.com/opensourceways/community-robot-lib/robot-gitlab-framework"
 	"github.com/sirupsen/logrus"
 
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/mysql"
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/obsimpl"
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/platformimpl"
-	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synclockimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/sqldb"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synchistoryimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/synctaskimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
 	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
 )
 
+const metricsPath = "/metrics"
+
 type options struct {
 	service liboptions.ServiceOptions
 
@@ -44,6 +51,22 @@ func main() {
 	logrusutil.ComponentInit(botName)
 	log := logrus.NewEntry(logrus.StandardLogger())
 
+	if len(os.Args) > 1 && os.Args[1] == cmdReconcile {
+		if err := runReconcile(log, os.Args[2:]); err != nil {
+			log.Fatalf("reconcile failed, err:%s", err.Error())
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == cmdMigrate {
+		if err := runMigrate(log, os.Args[2:]); err != nil {
+			log.Fatalf("migrate failed, err:%s", err.Error())
+		}
+
+		return
+	}
+
 	o := gatherOptions(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:]...)
 	if err := o.Validate(); err != nil {
 		logrus.WithError(err).Fatal("Invalid options")
@@ -62,44 +85,104 @@ func main() {
 		return
 	}
 
-	// gitlab
-	gitlab, err := platformimpl.NewPlatform(&cfg.Gitlab)
+	ss, err := initServices(&cfg, log)
 	if err != nil {
-		log.Errorf("init gitlab platform failed, err:%s", err.Error())
+		log.Errorf("init services failed, err:%s", err.Error())
 
 		return
 	}
 
-	// obs service
-	obsService, err := obsimpl.NewOBS(&cfg.OBS)
-	if err != nil {
-		log.Errorf("init obs service failed, err:%s", err.Error())
+	lifecycle := sync.NewLifecycleService(&cfg.Sync, log, ss.obs, ss.lock)
+	lifecycle.Run()
 
-		return
+	// the failed syncs and changes of repos are retried in background.
+	retrier := sync.NewSyncRetrier(
+		&cfg.Sync.RetryConfig, ss.service, lifecycle,
+		synctaskimpl.NewSyncTask(sqldb.NewSyncTaskMapper(ss.db)), log,
+	)
+
+	queue := sync.NewSyncQueue(cfg.Sync.WorkerNum, retrier, log)
+
+	retrier.Run(queue)
+
+	r := newRobot(queue, retrier, ss.platform)
+
+	// the handlers are served by the framework together with the webhook
+	// of gitlab which is not used for the other platforms.
+	if a := newWebhookAdapter(cfg.Platform); a != nil {
+		http.Handle(cfg.Webhook.Path, newWebhook(&cfg.Webhook, a, r, log))
+	}
+
+	if cfg.Platform == platformGitlab && cfg.SystemHook.Token != "" {
+		http.Handle(cfg.SystemHook.Path, newSystemHook(cfg.SystemHook.Token, r, log))
+	}
+
+	metrics.RegisterStuckLocks(func() (int, error) {
+		return sync.CountStuckLocks(ss.lock)
+	})
+	http.Handle(metricsPath, metrics.Handler())
+
+	if cfg.Admin.Token != "" {
+		admin := sync.NewAdminService(ss.service, queue, ss.lock, ss.history)
+		newAdminHandler(&cfg.Admin, admin, log).register(http.DefaultServeMux)
 	}
 
-	// mysql
-	if err := mysql.Init(&cfg.Mysql); err != nil {
-		log.Errorf("init mysql failed, err:%s", err.Error())
+	framework.Run(r, o.service.Port, o.service.GracePeriod)
+
+	retrier.Stop()
+
+	// the pending syncs have been accepted, so they are saved as tasks.
+	for _, info := range queue.Stop() {
+		if err := retrier.Defer(&info); err != nil {
+			log.Errorf(
+				"save the pending sync of repo(%s) failed, err:%s",
+				info.String(), err.Error(),
+			)
+		}
+	}
+
+	lifecycle.Stop()
+}
 
+type services struct {
+	db       *sqldb.Client
+	obs      obs.OBS
+	lock     synclock.RepoSyncLock
+	history  synchistory.SyncHistory
+	service  sync.SyncService
+	platform platform.Platform
+}
+
+func initServices(cfg *configuration, log *logrus.Entry) (s services, err error) {
+	// platform
+	if s.platform, err = newPlatform(&cfg.platformConfig); err != nil {
 		return
 	}
 
-	lock := synclockimpl.NewRepoSyncLock(mysql.NewSyncLockMapper())
+	// object storage
+	if s.obs, err = newStorage(&cfg.storageConfig); err != nil {
+		return
+	}
 
-	// sync service
-	service, err := sync.NewSyncService(
-		&cfg.Sync, log, obsService, gitlab, lock,
-	)
-	if err != nil {
-		log.Errorf("init sync service failed, err:%s", err.Error())
+	// database
+	if s.db, err = newDatabase(&cfg.databaseConfig); err != nil {
+		return
+	}
+
+	if err = migrateDatabase(&cfg.databaseConfig, s.db, log); err != nil {
+		return
+	}
 
+	if s.lock, err = newLock(&cfg.lockConfig, s.db); err != nil {
 		return
 	}
 
-	r := newRobot(
-		cfg.AccessHmac, cfg.AccessEndpoint, service,
+	s.history = synchistoryimpl.NewSyncHistory(sqldb.NewSyncHistoryMapper(s.db))
+
+	// sync service
+	s.service, err = sync.NewSyncService(
+		&cfg.Sync, log, s.obs, s.platform, s.lock, s.history,
 	)
 
-	framework.Run(r, o.service.Port, o.service.GracePeriod)
+	return
 }
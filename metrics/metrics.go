@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gitlab_sync"
+
+// the stages where a sync fails.
+const (
+	StageLock       = "lock"
+	StagePlatform   = "platform"
+	StageEngine     = "engine"
+	StageLFSCopy    = "lfs_copy"
+	StageVerify     = "verify"
+	StageCommitSave = "commit_save"
+	StageUnlock     = "unlock"
+)
+
+var (
+	Events = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "The number of events received, by the kind of event.",
+	}, []string{"event"})
+
+	SyncsStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_started_total",
+		Help:      "The number of syncs started.",
+	})
+
+	SyncsSucceeded = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_succeeded_total",
+		Help:      "The number of syncs succeeded.",
+	})
+
+	SyncsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_failed_total",
+		Help:      "The number of syncs failed, by the stage where it fails.",
+	}, []string{"stage"})
+
+	SyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "The duration of syncs, by the result of sync.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"result"})
+
+	UploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "The bytes of files uploaded.",
+	})
+
+	UploadedObjects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_objects_total",
+		Help:      "The number of files uploaded.",
+	})
+
+	LFSCopies = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lfs_copies_total",
+		Help:      "The number of lfs objects copied.",
+	})
+
+	RetryAttempts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retry_attempts_total",
+		Help:      "The number of attempts retried after the failures.",
+	})
+
+	LockTakeovers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lock_takeovers_total",
+		Help:      "The number of expired sync locks taken over by this instance.",
+	})
+
+	RunningSyncs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "running_syncs",
+		Help:      "The number of syncs running in this instance.",
+	})
+)
+
+// RegisterStuckLocks registers the gauge of locks stuck in running state
+// which is counted by f when it is scraped.
+func RegisterStuckLocks(f func() (int, error)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stuck_locks",
+		Help:      "The number of locks in running state whose lease expires.",
+	}, func() float64 {
+		n, err := f()
+		if err != nil {
+			return -1
+		}
+
+		return float64(n)
+	})
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/sirupsen/logrus"
+)
+
+const cmdMigrate = "migrate"
+
+// runMigrate upgrades the schema of database to the latest version. It is
+// used when the migration at startup is skipped.
+func runMigrate(log *logrus.Entry, args []string) error {
+	var configFile string
+
+	fs := flag.NewFlagSet(cmdMigrate, flag.ExitOnError)
+	fs.StringVar(&configFile, "config-file", "", "Path to config file.")
+	fs.Parse(args)
+
+	if configFile == "" {
+		return errors.New("config-file must be set")
+	}
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	db, err := newDatabase(&cfg.databaseConfig)
+	if err != nil {
+		return err
+	}
+
+	v, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("the schema of database is at version %d", v)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/platformimpl"
+)
+
+const (
+	platformGitlab = "gitlab"
+	platformGitHub = "github"
+	platformGitea  = "gitea"
+	platformGitee  = "gitee"
+)
+
+type platformConfig struct {
+	// Platform is where the repos are hosted, gitlab, github, gitea or
+	// gitee. Default is gitlab.
+	Platform string `json:"platform"`
+
+	// Only the config of Platform is required.
+	Gitlab *platformimpl.Config `json:"gitlab"`
+	GitHub *platformimpl.Config `json:"github"`
+	Gitea  *platformimpl.Config `json:"gitea"`
+	Gitee  *platformimpl.Config `json:"gitee"`
+
+	// Webhook is the webhook of platform except gitlab whose webhook
+	// is handled by the framework.
+	Webhook webhookConfig `json:"webhook"`
+}
+
+func (cfg *platformConfig) SetDefault() {
+	if cfg.Platform == "" {
+		cfg.Platform = platformGitlab
+	}
+
+	cfg.Webhook.SetDefault()
+}
+
+func (cfg *platformConfig) Validate() error {
+	if cfg.platformImplConfig() == nil {
+		return errors.New("missing the config of platform " + cfg.Platform)
+	}
+
+	if cfg.Platform != platformGitlab && cfg.Webhook.Secret == "" {
+		return errors.New("missing the secret of webhook")
+	}
+
+	return nil
+}
+
+func (cfg *platformConfig) platformImplConfig() *platformimpl.Config {
+	switch cfg.Platform {
+	case platformGitlab:
+		return cfg.Gitlab
+	case platformGitHub:
+		return cfg.GitHub
+	case platformGitea:
+		return cfg.Gitea
+	case platformGitee:
+		return cfg.Gitee
+	default:
+		return nil
+	}
+}
+
+func newPlatform(cfg *platformConfig) (platform.Platform, error) {
+	v := cfg.platformImplConfig()
+
+	switch cfg.Platform {
+	case platformGitHub:
+		return platformimpl.NewGitHub(v)
+	case platformGitea:
+		return platformimpl.NewGitea(v)
+	case platformGitee:
+		return platformimpl.NewGitee(v)
+	default:
+		return platformimpl.NewPlatform(v)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
+)
+
+const cmdReconcile = "reconcile"
+
+type reconcileOptions struct {
+	configFile string
+	owner      string
+	repoId     string
+	repoName   string
+	ref        string
+	dryRun     bool
+}
+
+func (o *reconcileOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.configFile, "config-file", "", "Path to config file.")
+	fs.StringVar(&o.owner, "owner", "", "The owner of repo.")
+	fs.StringVar(&o.repoId, "repo-id", "", "The id of repo.")
+	fs.StringVar(&o.repoName, "repo-name", "", "The name of repo.")
+	fs.StringVar(
+		&o.ref, "ref", "",
+		"The full name of branch or tag. The default branch is used if it is empty.",
+	)
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Only print the difference.")
+}
+
+func (o *reconcileOptions) validate() error {
+	if o.configFile == "" || o.owner == "" || o.repoId == "" || o.repoName == "" {
+		return errors.New("config-file, owner, repo-id and repo-name must be set")
+	}
+
+	return nil
+}
+
+// runReconcile repairs the mirror of a repo, or prints the difference only
+// if it is a dry run.
+func runReconcile(log *logrus.Entry, args []string) error {
+	var o reconcileOptions
+
+	fs := flag.NewFlagSet(cmdReconcile, flag.ExitOnError)
+	o.addFlags(fs)
+	fs.Parse(args)
+
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	owner, err := domain.NewAccount(o.owner)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+
+	ss, err := initServices(&cfg, log)
+	if err != nil {
+		return err
+	}
+
+	r, err := ss.service.Reconcile(&sync.RepoInfo{
+		Owner:    owner,
+		RepoId:   o.repoId,
+		RepoName: o.repoName,
+		Ref:      o.ref,
+	}, o.dryRun)
+	if err != nil {
+		return err
+	}
+
+	printReconcileResult(&r)
+
+	return nil
+}
+
+func printReconcileResult(r *sync.ReconcileResult) {
+	fmt.Printf("last commit: %s\n", r.LastCommit)
+
+	for _, v := range r.Missing {
+		fmt.Printf("+ %s\n", v)
+	}
+
+	for _, v := range r.Changed {
+		fmt.Printf("~ %s\n", v)
+	}
+
+	for _, v := range r.Orphaned {
+		fmt.Printf("- %s\n", v)
+	}
+}
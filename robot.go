@@ -1,83 +1,132 @@
 package main
 
 import (
-	"bytes"
-	"net/http"
+	"errors"
 	"strconv"
 
-	"github.com/opensourceways/community-robot-lib/utils"
 	"github.com/sirupsen/logrus"
 	sdk "github.com/xanzy/go-gitlab"
 
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
 	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
 )
 
-const botName = "sync_repo"
+const (
+	botName = "sync_repo"
 
-func newRobot(hmac, endpoint string, s sync.SyncService) *robot {
+	refBranchPrefix = "refs/heads/"
+	refTagPrefix    = "refs/tags/"
+
+	// zeroCommit is the commit of push event which deletes a branch or tag.
+	zeroCommit = "0000000000000000000000000000000000000000"
+)
+
+func newRobot(q sync.SyncQueue, r sync.SyncRetrier, p platform.Platform) *robot {
 	return &robot{
-		hmac:     hmac,
-		endpoint: endpoint,
-		service:  s,
-		hc:       utils.HttpClient{MaxRetries: 3},
+		queue:   q,
+		retrier: r,
+		ph:      p,
 	}
 }
 
 type robot struct {
-	hmac     string
-	endpoint string
-	hc       utils.HttpClient
-	service  sync.SyncService
+	queue sync.SyncQueue
+	// retrier applies the changes of repo in background and retries
+	// the failed ones.
+	retrier sync.SyncRetrier
+	ph      platform.Platform
 }
 
 func (bot *robot) HandlePushEvent(e *sdk.PushEvent, log *logrus.Entry) (err error) {
-	repoName := e.Project.Name
+	metrics.Events.WithLabelValues(eventPush).Inc()
 
-	owner, err := domain.NewAccount(e.Project.Namespace)
+	v, err := newPushRepoInfo(
+		e.Project.Namespace, strconv.Itoa(e.ProjectID),
+		e.Project.Name, e.Ref, e.Project.DefaultBranch,
+	)
 	if err != nil {
 		return
 	}
 
-	v := sync.RepoInfo{
-		Owner:    owner,
-		RepoId:   strconv.Itoa(e.ProjectID),
-		RepoName: repoName,
+	return bot.handleRefChange(&v, e.After == zeroCommit)
+}
+
+// newPushRepoInfo returns the repo info of the pushed ref. The default
+// branch is synced without ref to keep the layout of obs.
+// The push is rejected if the default branch is unknown, otherwise every
+// ref of it would be synced to the mirror of default branch.
+func newPushRepoInfo(owner, repoId, repoName, ref, defaultBranch string) (
+	v sync.RepoInfo, err error,
+) {
+	if defaultBranch == "" {
+		err = errors.New("unknown default branch of repo: " + repoId)
+
+		return
 	}
 
-	if err = bot.service.SyncRepo(&v); err == nil {
+	if v.Owner, err = domain.NewAccount(owner); err != nil {
 		return
 	}
 
-	if err1 := bot.sendBack(e); err1 != nil {
-		log.Errorf(
-			"sync repo failed and send back event failed, err:%s.",
-			err1.Error(),
-		)
+	v.RepoId = repoId
+	v.RepoName = repoName
+
+	if ref != refBranchPrefix+defaultBranch {
+		v.Ref = ref
 	}
 
 	return
 }
 
-func (bot *robot) sendBack(e *sdk.PushEvent) error {
-	body, err := utils.JsonMarshal(e)
+// handleRefChange syncs the pushed branch or tag, or removes the mirror
+// of it if it is deleted.
+// The events are acknowledged at once, and handled in background. The
+// failed ones will be retried by the sync retrier. The error is returned
+// only if the change is not saved, so that the platform may redeliver it.
+func (bot *robot) handleRefChange(info *sync.RepoInfo, deleted bool) error {
+	if !deleted {
+		bot.queue.Push(info, nil)
+
+		return nil
+	}
+
+	if info.Ref == "" {
+		return nil
+	}
+
+	return bot.retrier.ApplyChange(domain.SyncTaskActionDeleteRef, info)
+}
+
+// deleteRepo removes the mirror of repo. The mirrors are found by the repo
+// id, and the owner is only the key of the task.
+func (bot *robot) deleteRepo(owner, repoId string) error {
+	v, err := domain.NewAccount(owner)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(
-		http.MethodPost, bot.endpoint, bytes.NewBuffer(body),
+	return bot.retrier.ApplyChange(
+		domain.SyncTaskActionDeleteRepo,
+		&sync.RepoInfo{Owner: v, RepoId: repoId},
 	)
+}
+
+// moveRepo moves the mirror of repo if its owner is changed.
+func (bot *robot) moveRepo(repoId string) error {
+	v, err := bot.ph.GetRepoOwner(repoId)
 	if err != nil {
 		return err
 	}
 
-	h := &req.Header
-	h.Add("Content-Type", "application/json")
-	h.Add("User-Agent", botName)
-	h.Add("X-Gitlab-Event", "System Hook")
-	h.Add("X-Gitlab-Token", bot.hmac)
-	h.Add("X-Gitlab-Event-UUID", "73ed8438-1119-4bb8-ae9d-0180c88ef168")
+	owner, err := domain.NewAccount(v)
+	if err != nil {
+		return err
+	}
 
-	return bot.hc.ForwardTo(req, nil)
+	return bot.retrier.ApplyChange(
+		domain.SyncTaskActionMoveRepo,
+		&sync.RepoInfo{Owner: owner, RepoId: repoId},
+	)
 }
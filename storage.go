@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/limitimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/localimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/obsimpl"
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/s3impl"
+)
+
+const (
+	storageOBS   = "obs"
+	storageS3    = "s3"
+	storageLocal = "local"
+)
+
+type storageConfig struct {
+	// Storage is the object storage which the repos are synced to,
+	// obs, s3 or local. Default is obs.
+	Storage string `json:"storage"`
+
+	// OBS is the config of Huawei OBS, S3 is the config of any S3
+	// compatible storage, and Local is the config of local directory
+	// which is used for testing and offline deployment.
+	// Only the one of Storage is required.
+	OBS   *obsimpl.Config   `json:"obs"`
+	S3    *s3impl.Config    `json:"s3"`
+	Local *localimpl.Config `json:"local"`
+
+	// MaxConcurrency is the max number of operations on the storage at
+	// the same time. It is unlimited if 0.
+	// An upload of file counts as one operation, even if it is uploaded by
+	// multipart. The parts of a file are uploaded one by one for s3, but
+	// 4 at the same time for obs, so the requests to obs may be up to 4
+	// times of it.
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+func (cfg *storageConfig) SetDefault() {
+	if cfg.Storage == "" {
+		cfg.Storage = storageOBS
+	}
+}
+
+func (cfg *storageConfig) Validate() error {
+	if cfg.MaxConcurrency < 0 {
+		return errors.New("max_concurrency can't be negative")
+	}
+
+	switch cfg.Storage {
+	case storageOBS:
+		if cfg.OBS == nil {
+			return errors.New("missing the config of obs")
+		}
+
+		return cfg.OBS.Validate()
+
+	case storageS3:
+		if cfg.S3 == nil {
+			return errors.New("missing the config of s3")
+		}
+
+	case storageLocal:
+		if cfg.Local == nil {
+			return errors.New("missing the config of local")
+		}
+
+		return cfg.Local.Validate()
+
+	default:
+		return errors.New("unknown storage")
+	}
+
+	return nil
+}
+
+func newStorage(cfg *storageConfig) (obs.OBS, error) {
+	s, err := newStorageBackend(cfg)
+	if err != nil || cfg.MaxConcurrency == 0 {
+		return s, err
+	}
+
+	return limitimpl.NewLimitedOBS(s, cfg.MaxConcurrency), nil
+}
+
+func newStorageBackend(cfg *storageConfig) (obs.OBS, error) {
+	switch cfg.Storage {
+	case storageS3:
+		return s3impl.NewS3(cfg.S3)
+
+	case storageLocal:
+		return localimpl.NewLocal(cfg.Local)
+
+	default:
+		return obsimpl.NewOBS(cfg.OBS)
+	}
+}
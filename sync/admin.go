@@ -0,0 +1,207 @@
+package sync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	gosync "sync"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+)
+
+// AdminService is used by the administrators to inspect and operate the syncs.
+type AdminService interface {
+	ListLocks(*synclock.ListOption) ([]domain.RepoSyncLock, error)
+	GetLock(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error)
+
+	// ForceUnlock releases the running lock no matter whether its lease expires.
+	// The holder, if it is still alive, will fail to save the lock after that.
+	// It does nothing if the lock is not running.
+	ForceUnlock(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error)
+
+	// Unblock makes the repo blocked after too many failures can be synced
+	// again, and the failures are cleared. The pushes skipped while it is
+	// blocked are recorded in the histories, and they are not synced until
+	// the next sync of repo.
+	Unblock(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error)
+
+	// TriggerSync adds a sync of repo to queue.
+	TriggerSync(*RepoInfo)
+
+	// StartReconcile runs the reconcile of repo in background, and its
+	// status can be got by GetReconcile with the id of returned job.
+	StartReconcile(info *RepoInfo, dryRun bool) (ReconcileJob, error)
+
+	// GetReconcile returns the reconcile job started by this instance.
+	// The finished jobs are kept for a while only.
+	GetReconcile(id string) (ReconcileJob, bool)
+
+	// ListHistories returns the sync histories and the total number of them.
+	ListHistories(*synchistory.ListOption) ([]domain.SyncHistory, int, error)
+}
+
+// reconcileJobRetention is how long the finished reconcile job is kept.
+const reconcileJobRetention = time.Hour
+
+// ReconcileJob is the reconcile running in background.
+type ReconcileJob struct {
+	Id        string
+	Repo      string
+	DryRun    bool
+	Done      bool
+	StartTime int64
+	EndTime   int64
+	Result    ReconcileResult
+	Error     string
+}
+
+func NewAdminService(
+	s SyncService, q SyncQueue,
+	l synclock.RepoSyncLock,
+	h synchistory.SyncHistory,
+) AdminService {
+	return &adminService{
+		service: s,
+		queue:   q,
+		lock:    l,
+		history: h,
+		jobs:    map[string]*ReconcileJob{},
+	}
+}
+
+type adminService struct {
+	service SyncService
+	queue   SyncQueue
+	lock    synclock.RepoSyncLock
+	history synchistory.SyncHistory
+
+	jobsLock gosync.Mutex
+	jobs     map[string]*ReconcileJob
+}
+
+func (s *adminService) ListLocks(opt *synclock.ListOption) ([]domain.RepoSyncLock, error) {
+	return s.lock.List(opt)
+}
+
+func (s *adminService) GetLock(owner domain.Account, repoId, ref string) (
+	domain.RepoSyncLock, error,
+) {
+	return s.lock.Find(owner, repoId, ref)
+}
+
+func (s *adminService) ForceUnlock(owner domain.Account, repoId, ref string) (
+	domain.RepoSyncLock, error,
+) {
+	c, err := s.lock.Find(owner, repoId, ref)
+	if err != nil {
+		return c, err
+	}
+
+	if !c.IsRunning() {
+		return c, nil
+	}
+
+	if err := c.Abort(); err != nil {
+		return c, err
+	}
+
+	return s.lock.Save(&c)
+}
+
+func (s *adminService) Unblock(owner domain.Account, repoId, ref string) (
+	domain.RepoSyncLock, error,
+) {
+	c, err := s.lock.Find(owner, repoId, ref)
+	if err != nil {
+		return c, err
+	}
+
+	if err := c.Unblock(); err != nil {
+		return c, err
+	}
+
+	return s.lock.Save(&c)
+}
+
+func (s *adminService) TriggerSync(info *RepoInfo) {
+	s.queue.Push(info, nil)
+}
+
+func (s *adminService) StartReconcile(info *RepoInfo, dryRun bool) (ReconcileJob, error) {
+	id, err := newJobId()
+	if err != nil {
+		return ReconcileJob{}, err
+	}
+
+	job := &ReconcileJob{
+		Id:        id,
+		Repo:      info.String(),
+		DryRun:    dryRun,
+		StartTime: time.Now().Unix(),
+	}
+
+	s.jobsLock.Lock()
+	s.pruneJobs()
+	s.jobs[id] = job
+	v := *job
+	s.jobsLock.Unlock()
+
+	repo := *info
+
+	go func() {
+		r, err := s.service.Reconcile(&repo, dryRun)
+
+		s.jobsLock.Lock()
+		defer s.jobsLock.Unlock()
+
+		job.Done = true
+		job.EndTime = time.Now().Unix()
+		job.Result = r
+		if err != nil {
+			job.Error = truncateError(err)
+		}
+	}()
+
+	return v, nil
+}
+
+func (s *adminService) GetReconcile(id string) (ReconcileJob, bool) {
+	s.jobsLock.Lock()
+	defer s.jobsLock.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return ReconcileJob{}, false
+	}
+
+	return *job, true
+}
+
+// pruneJobs removes the jobs finished long ago. It must be called with
+// jobsLock held.
+func (s *adminService) pruneJobs() {
+	expiry := time.Now().Add(-reconcileJobRetention).Unix()
+
+	for id, job := range s.jobs {
+		if job.Done && job.EndTime < expiry {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func (s *adminService) ListHistories(opt *synchistory.ListOption) (
+	[]domain.SyncHistory, int, error,
+) {
+	return s.history.List(opt)
+}
@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// reconcileService blocks the reconcile until it is released.
+type reconcileService struct {
+	SyncService
+
+	gate chan error
+}
+
+func (s *reconcileService) Reconcile(info *RepoInfo, dryRun bool) (ReconcileResult, error) {
+	err := <-s.gate
+
+	return ReconcileResult{LastCommit: "c", Missing: []string{info.RepoName}}, err
+}
+
+func waitReconcile(t *testing.T, s AdminService, id string) ReconcileJob {
+	for i := 0; i < 100; i++ {
+		if job, ok := s.GetReconcile(id); ok && job.Done {
+			return job
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("reconcile %s is not done", id)
+
+	return ReconcileJob{}
+}
+
+func TestStartReconcile(t *testing.T) {
+	rs := &reconcileService{gate: make(chan error)}
+	s := NewAdminService(rs, nil, nil, nil)
+
+	job, err := s.StartReconcile(testRepo("1", "repo"), true)
+	if err != nil || job.Id == "" || job.Done || !job.DryRun {
+		t.Fatalf("start reconcile: %+v, %v", job, err)
+	}
+
+	// it is running until the reconcile returns.
+	if v, ok := s.GetReconcile(job.Id); !ok || v.Done {
+		t.Fatalf("get running reconcile: %+v, %v", v, ok)
+	}
+
+	rs.gate <- nil
+
+	v := waitReconcile(t, s, job.Id)
+	if v.Error != "" || v.Result.LastCommit != "c" || len(v.Result.Missing) != 1 {
+		t.Fatalf("reconcile = %+v", v)
+	}
+
+	failed, _ := s.StartReconcile(testRepo("2", "repo"), false)
+	rs.gate <- errors.New("failed")
+
+	if v := waitReconcile(t, s, failed.Id); v.Error != "failed" {
+		t.Fatalf("error of reconcile = %q", v.Error)
+	}
+
+	if _, ok := s.GetReconcile("none"); ok {
+		t.Fatal("get the missing reconcile")
+	}
+}
@@ -2,24 +2,348 @@ package sync
 
 import (
 	"errors"
+	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
 )
 
+const (
+	refBranchPrefix = "refs/heads/"
+	refTagPrefix    = "refs/tags/"
+
+	refLayoutOwner  = "{owner}"
+	refLayoutType   = "{type}"
+	refLayoutRepoId = "{repo_id}"
+	refLayoutRef    = "{ref}"
+)
+
+var reLayoutPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
 type Config struct {
 	ServiceConfig
 
 	HelperConfig
+
+	QueueConfig
+
+	RetryConfig
+
+	LifecycleConfig
 }
 
 type ServiceConfig struct {
-	WorkDir       string `json:"work_dir"        required:"true"`
-	SyncFileShell string `json:"sync_file_shell" required:"true"`
+	WorkDir string `json:"work_dir" required:"true"`
+
+	// Engine is the way to sync files, native or shell. Default is native.
+	Engine string `json:"engine"`
+
+	// SyncFileShell is required when the engine is shell which only works
+	// with Huawei OBS. OBSUtilPath and OBSBucket are not configured here
+	// but set from the config of obs storage, and the obsutil must have
+	// been configured with the credentials.
+	SyncFileShell string `json:"sync_file_shell"`
+	OBSUtilPath   string `json:"-"`
+	OBSBucket     string `json:"-"`
+
+	// LargeFileSize is the minimum bytes of a large file. The renamed lfs
+	// and large files are copied inside obs instead of uploading again.
+	LargeFileSize int64 `json:"large_file_size"`
+
+	// UploadWorkers is the number of files uploaded or copied concurrently
+	// in a sync. UploadBandwidth is the bytes per second uploaded by all
+	// the syncs, and it is unlimited if 0.
+	UploadWorkers   int   `json:"upload_workers"`
+	UploadBandwidth int64 `json:"upload_bandwidth"`
+
+	// MultipartSize is the minimum bytes of a file uploaded by multipart,
+	// which is resumed from the checkpoint under WorkDir on retry or by the
+	// later sync of the same content. The multipart upload is paced by
+	// UploadBandwidth as the bytes are sent, while the smaller file is
+	// charged at once before it is sent.
+	MultipartSize int64 `json:"multipart_size"`
+
+	// MirrorCacheSize is the bytes of disk used by the bare mirrors of repos
+	// which are cached under WorkDir and fetched incrementally. The least
+	// recently used mirrors are removed when it is exceeded. The repos are
+	// cloned for every sync if it is 0. It only works with the native engine.
+	MirrorCacheSize int64 `json:"mirror_cache_size"`
+
+	// InstanceId identifies the instance which holds the sync lock.
+	InstanceId string `json:"instance_id"`
+
+	// RefPatterns is the patterns of branches and tags to be synced besides
+	// the default branch, like refs/heads/release-*, refs/tags/*.
+	// Each segment between / is matched by path.Match, so * does not match
+	// /, and a segment of ** matches any number of segments, like
+	// refs/heads/release/** matches refs/heads/release/1.x/hotfix.
+	RefPatterns []string `json:"ref_patterns"`
+
+	// Verify checks the objects of changed files after sync. The sync fails
+	// and the last commit is not updated if there is any mismatch and
+	// FailOnMismatch is true.
+	Verify         bool `json:"verify"`
+	FailOnMismatch bool `json:"fail_on_mismatch"`
+
+	// LeaseDuration is the seconds that a running sync lock is valid
+	// without renewal. The lock can be taken over after it expires.
+	LeaseDuration int `json:"lease_duration"`
+
+	// MaxFailures is the number of consecutive failed syncs after which
+	// the repo is blocked until it is unblocked by the administrator.
+	// It is 5 if not set, and 0 means the repo is never blocked.
+	MaxFailures *int `json:"max_failures"`
+
+	// Policies is the sync policy of each resource type, like project,
+	// model and dataset. The type without policy uses the config above.
+	Policies map[string]SyncPolicy `json:"policies"`
+}
+
+// SyncPolicy overrides the config of sync for a resource type.
+type SyncPolicy struct {
+	// Disabled stops syncing the repos of the type.
+	Disabled bool `json:"disabled"`
+
+	// RefPatterns replaces the global one if it is not empty.
+	RefPatterns []string `json:"ref_patterns"`
+
+	// MaxFailures replaces the global one if it is set, and 0 means the
+	// repos of the type are never blocked.
+	MaxFailures *int `json:"max_failures"`
+}
+
+// maxFailures returns the max failures of the merged policy, and 0 means
+// never blocking.
+func (p *SyncPolicy) maxFailures() int {
+	if p.MaxFailures == nil {
+		return 0
+	}
+
+	return *p.MaxFailures
+}
+
+// policy returns the sync policy of resource type which is merged with
+// the global config.
+func (c *ServiceConfig) policy(t domain.ResourceType) SyncPolicy {
+	p := SyncPolicy{}
+	if t != nil {
+		p = c.Policies[t.ResourceType()]
+	}
+
+	if len(p.RefPatterns) == 0 {
+		p.RefPatterns = c.RefPatterns
+	}
+
+	if p.MaxFailures == nil {
+		p.MaxFailures = c.MaxFailures
+	}
+
+	return p
+}
+
+// IsShellEngine checks whether the files are synced by the sync shell.
+func (c *ServiceConfig) IsShellEngine() bool {
+	return c.Engine == engineShell
+}
+
+func (p *SyncPolicy) isRefAllowed(ref string) bool {
+	if ref == "" {
+		return true
+	}
+
+	for _, p := range p.RefPatterns {
+		if matchRef(strings.Split(p, "/"), strings.Split(ref, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRef matches the segments of ref with the ones of pattern, and the
+// segment of ** matches zero or more segments.
+func matchRef(pattern, ref []string) bool {
+	for i, p := range pattern {
+		if p == "**" {
+			for j := i; j <= len(ref); j++ {
+				if matchRef(pattern[i+1:], ref[j:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if i >= len(ref) {
+			return false
+		}
+
+		if ok, _ := path.Match(p, ref[i]); !ok {
+			return false
+		}
+	}
+
+	return len(pattern) == len(ref)
+}
+
+func (c *ServiceConfig) SetDefault() {
+	if c.Engine == "" {
+		c.Engine = engineNative
+	}
+
+	if c.InstanceId == "" {
+		c.InstanceId, _ = os.Hostname()
+	}
+
+	if c.LargeFileSize <= 0 {
+		c.LargeFileSize = 5 << 20
+	}
+
+	if c.LeaseDuration <= 0 {
+		c.LeaseDuration = 300
+	}
+
+	if c.UploadWorkers <= 0 {
+		c.UploadWorkers = 4
+	}
+
+	if c.MultipartSize <= 0 {
+		c.MultipartSize = 100 << 20
+	}
+
+	if c.MaxFailures == nil {
+		v := 5
+		c.MaxFailures = &v
+	}
+}
+
+type QueueConfig struct {
+	// WorkerNum is the number of repos which can be synced concurrently.
+	WorkerNum int `json:"worker_num"`
+}
+
+func (c *QueueConfig) SetDefault() {
+	if c.WorkerNum <= 0 {
+		c.WorkerNum = 2
+	}
+}
+
+type RetryConfig struct {
+	// RetryInterval is the seconds between two scans of due tasks.
+	RetryInterval int `json:"retry_interval"`
+	RetryBatch    int `json:"retry_batch"`
+
+	// MaxAttempts is the times of failure before a task is dead.
+	MaxAttempts int `json:"max_attempts"`
+
+	// BackoffBase and BackoffMax are the seconds of delay between retries.
+	BackoffBase int `json:"backoff_base"`
+	BackoffMax  int `json:"backoff_max"`
+}
+
+func (c *RetryConfig) SetDefault() {
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = 60
+	}
+
+	if c.RetryBatch <= 0 {
+		c.RetryBatch = 100
+	}
+
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+
+	if c.BackoffBase <= 0 {
+		c.BackoffBase = 60
+	}
+
+	if c.BackoffMax <= 0 {
+		c.BackoffMax = 6 * 3600
+	}
+}
+
+type LifecycleConfig struct {
+	// DeletePolicy is the way to handle the mirror of deleted repo, branch
+	// or tag. It is delete or archive which moves the mirror to TrashPath.
+	DeletePolicy string `json:"delete_policy"`
+	TrashPath    string `json:"trash_path"`
+
+	// TrashRetention is the days to keep the archived mirror.
+	TrashRetention int `json:"trash_retention"`
+}
+
+func (c *LifecycleConfig) SetDefault() {
+	if c.DeletePolicy == "" {
+		c.DeletePolicy = deletePolicyArchive
+	}
+
+	if c.TrashPath == "" {
+		c.TrashPath = "trash"
+	}
+
+	if c.TrashRetention <= 0 {
+		c.TrashRetention = 30
+	}
 }
 
 type HelperConfig struct {
 	LFSPath    string `json:"lfs_path"    required:"true"`
 	RepoPath   string `json:"repo_path"   required:"true"`
 	CommitFile string `json:"commit_file" required:"true"`
+
+	// RepoLayout is the path of the default branch, and RefLayout is
+	// the path of the other branches and tags. They are relative to
+	// RepoPath and support the placeholders of {owner}, {type}, {repo_id}
+	// and {ref} which is like heads/dev or tags/v1.0.
+	//
+	// The default RepoLayout is {owner}/{repo_id} which is the layout of
+	// the existing mirrors, so {type} must be added explicitly, such as
+	// {owner}/{type}/{repo_id}. The mirrors must be moved to the new paths
+	// before changing it, because the sync only uploads the files changed
+	// after the last synced commit.
+	//
+	// The default RefLayout is {owner}/{repo_id}@refs/{ref}. It can't be
+	// under the path of default branch, such as {owner}/{repo_id}/refs/{ref},
+	// otherwise the mirrors of refs are mixed with the files of default
+	// branch and are deleted by the sync and reconcile of it.
+	RepoLayout string `json:"repo_layout"`
+	RefLayout  string `json:"ref_layout"`
+
+	// DefaultRepoType is the resource type of repo which is not marked
+	// with any type on the platform. Default is project.
+	DefaultRepoType string `json:"default_repo_type"`
+}
+
+func (c *HelperConfig) SetDefault() {
+	if c.RepoLayout == "" {
+		c.RepoLayout = "{owner}/{repo_id}"
+	}
+
+	if c.RefLayout == "" {
+		c.RefLayout = "{owner}/{repo_id}@refs/{ref}"
+	}
+
+	if c.DefaultRepoType == "" {
+		c.DefaultRepoType = domain.ResourceTypeProject.ResourceType()
+	}
+}
+
+func (c *HelperConfig) defaultRepoType() domain.ResourceType {
+	t, _ := domain.NewResourceType(c.DefaultRepoType)
+
+	return t
+}
+
+func (c *Config) SetDefault() {
+	c.ServiceConfig.SetDefault()
+	c.QueueConfig.SetDefault()
+	c.RetryConfig.SetDefault()
+	c.HelperConfig.SetDefault()
+	c.LifecycleConfig.SetDefault()
 }
 
 func (c *Config) Validate() error {
@@ -27,8 +351,18 @@ func (c *Config) Validate() error {
 		return errors.New("work_dir must be an absolute path")
 	}
 
-	if !filepath.IsAbs(c.SyncFileShell) {
-		return errors.New("sync_file_shell must be an absolute path")
+	switch c.Engine {
+	case engineNative:
+	case engineShell:
+		if !filepath.IsAbs(c.SyncFileShell) {
+			return errors.New("sync_file_shell must be an absolute path")
+		}
+
+		if !filepath.IsAbs(c.OBSUtilPath) || c.OBSBucket == "" {
+			return errors.New("the shell engine requires the obsutil_path and bucket of obs")
+		}
+	default:
+		return errors.New("unknown engine")
 	}
 
 	if filepath.IsAbs(c.LFSPath) {
@@ -39,5 +373,117 @@ func (c *Config) Validate() error {
 		return errors.New("repo_path can't start with /")
 	}
 
+	if filepath.IsAbs(c.RepoLayout) || filepath.IsAbs(c.RefLayout) {
+		return errors.New("repo_layout and ref_layout can't start with /")
+	}
+
+	if err := validateLayout(c.RepoLayout); err != nil {
+		return errors.New("invalid repo_layout, " + err.Error())
+	}
+
+	if err := validateLayout(c.RefLayout); err != nil {
+		return errors.New("invalid ref_layout, " + err.Error())
+	}
+
+	if !strings.Contains(c.RepoLayout, refLayoutRepoId) ||
+		strings.Contains(c.RepoLayout, refLayoutRef) {
+		return errors.New("repo_layout must contain {repo_id} but not {ref}")
+	}
+
+	if !strings.Contains(c.RefLayout, refLayoutRepoId) ||
+		!strings.Contains(c.RefLayout, refLayoutRef) {
+		return errors.New("ref_layout must contain {repo_id} and {ref}")
+	}
+
+	if isLayoutNested(c.RepoLayout, c.RefLayout) {
+		return errors.New("ref_layout can't be under repo_layout or contain it")
+	}
+
+	if c.DeletePolicy != deletePolicyDelete && c.DeletePolicy != deletePolicyArchive {
+		return errors.New("delete_policy must be delete or archive")
+	}
+
+	if filepath.IsAbs(c.TrashPath) {
+		return errors.New("trash_path can't start with /")
+	}
+
+	if _, err := domain.NewResourceType(c.DefaultRepoType); err != nil {
+		return errors.New("invalid default_repo_type: " + c.DefaultRepoType)
+	}
+
+	if err := validateRefPatterns(c.RefPatterns); err != nil {
+		return err
+	}
+
+	for k, v := range c.Policies {
+		if t, err := domain.NewResourceType(k); err != nil || t == nil {
+			return errors.New("invalid resource type of policy: " + k)
+		}
+
+		if err := validateRefPatterns(v.RefPatterns); err != nil {
+			return err
+		}
+
+		if v.MaxFailures != nil && *v.MaxFailures < 0 {
+			return errors.New("max_failures of policy can't be negative: " + k)
+		}
+	}
+
+	if c.MaxFailures != nil && *c.MaxFailures < 0 {
+		return errors.New("max_failures can't be negative")
+	}
+
+	if c.InstanceId == "" {
+		return errors.New("missing instance_id")
+	}
+
+	if c.UploadBandwidth < 0 {
+		return errors.New("upload_bandwidth can't be negative")
+	}
+
+	if c.MirrorCacheSize < 0 {
+		return errors.New("mirror_cache_size can't be negative")
+	}
+
+	return nil
+}
+
+// validateLayout checks that the layout only contains the known placeholders.
+func validateLayout(layout string) error {
+	for _, v := range reLayoutPlaceholder.FindAllString(layout, -1) {
+		switch v {
+		case refLayoutOwner, refLayoutType, refLayoutRepoId, refLayoutRef:
+		default:
+			return errors.New("unknown placeholder: " + v)
+		}
+	}
+
+	return nil
+}
+
+// isLayoutNested checks whether the path of a ref is under the path of
+// default branch of the same repo, or the reverse.
+func isLayoutNested(repoLayout, refLayout string) bool {
+	r := strings.NewReplacer(
+		refLayoutOwner, "owner",
+		refLayoutType, domain.ResourceTypeProject.ResourceType(),
+		refLayoutRepoId, "1",
+		refLayoutRef, "heads/dev",
+	)
+
+	repo := filepath.Clean(r.Replace(repoLayout))
+	ref := filepath.Clean(r.Replace(refLayout))
+
+	return repo == ref ||
+		strings.HasPrefix(ref, repo+"/") || strings.HasPrefix(repo, ref+"/")
+}
+
+func validateRefPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.New("invalid ref pattern: " + p)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,33 @@
+package sync
+
+import "testing"
+
+func TestIsRefAllowed(t *testing.T) {
+	p := SyncPolicy{RefPatterns: []string{
+		"refs/heads/release-*", "refs/heads/stable/**", "refs/tags/**/rc",
+	}}
+
+	cases := []struct {
+		ref  string
+		want bool
+	}{
+		{"", true},
+		{"refs/heads/release-1.0", true},
+		{"refs/heads/release-1.0/hotfix", false},
+		{"refs/heads/stable", true},
+		{"refs/heads/stable/1.x", true},
+		{"refs/heads/stable/1.x/hotfix", true},
+		{"refs/heads/stable-1.x", false},
+		{"refs/tags/rc", true},
+		{"refs/tags/v1/rc", true},
+		{"refs/tags/v1/2/rc", true},
+		{"refs/tags/v1/rc/1", false},
+		{"refs/heads/master", false},
+	}
+
+	for _, c := range cases {
+		if v := p.isRefAllowed(c.ref); v != c.want {
+			t.Errorf("isRefAllowed(%q) = %v, want %v", c.ref, v, c.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package sync
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+)
+
+const (
+	askPassFile = "git-askpass.sh"
+
+	envGitUsername = "SYNC_GIT_USERNAME"
+	envGitPassword = "SYNC_GIT_PASSWORD"
+
+	// askPassScript is called by git with the prompt to get the credential
+	// from the environment, so it never appears in the command line.
+	askPassScript = `#!/bin/sh
+case "$1" in
+Username*) printf '%s\n' "$` + envGitUsername + `" ;;
+*) printf '%s\n' "$` + envGitPassword + `" ;;
+esac
+`
+)
+
+// writeAskPass writes the script of GIT_ASKPASS under dir.
+func writeAskPass(dir string) (string, error) {
+	p := filepath.Join(dir, askPassFile)
+
+	return p, ioutil.WriteFile(p, []byte(askPassScript), 0700)
+}
+
+// gitCredentialEnv returns the environment which supplies the credential
+// to git by the askpass script.
+func gitCredentialEnv(askPass string, c platform.Credential) []string {
+	return []string{
+		"GIT_ASKPASS=" + askPass,
+		"GIT_TERMINAL_PROMPT=0",
+		envGitUsername + "=" + c.Username,
+		envGitPassword + "=" + c.Password,
+	}
+}
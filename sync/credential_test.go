@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+func TestTokenNotLogged(t *testing.T) {
+	const (
+		urlToken = "url-token-7f3a9c"
+		envToken = "env-token-2b8e4d"
+	)
+
+	// the token of platform is registered when the platform is created.
+	utils.AddSecret(envToken)
+
+	cases := []struct {
+		name     string
+		cloneURL string
+		token    string
+	}{
+		{
+			name:     "token in the user info of url",
+			cloneURL: "http://user:" + urlToken + "@127.0.0.1:1/owner/repo.git",
+			token:    urlToken,
+		},
+		{
+			name:     "registered token",
+			cloneURL: "http://127.0.0.1:1/" + envToken + "/repo.git",
+			token:    envToken,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			askPass, err := writeAskPass(dir)
+			if err != nil {
+				t.Fatalf("write askpass: %v", err)
+			}
+
+			buf := new(bytes.Buffer)
+			logger := logrus.New()
+			logger.SetOutput(buf)
+			logger.SetLevel(logrus.DebugLevel)
+			log := logrus.NewEntry(logger)
+
+			e := newNativeEngine(nil, &ServiceConfig{WorkDir: dir}, nil, log)
+
+			_, err = e.Sync(&SyncOption{
+				WorkDir:  dir,
+				CloneURL: c.cloneURL,
+				Env: gitCredentialEnv(askPass, platform.Credential{
+					Username: "user",
+					Password: envToken,
+				}),
+				RepoName: "repo",
+				OBSPath:  filepath.Join("repo", "owner", "1"),
+			})
+			if err == nil {
+				t.Fatal("sync from an unreachable repo, want error")
+			}
+
+			log.Errorf("sync repo failed, err:%s", err.Error())
+
+			if strings.Contains(err.Error(), c.token) {
+				t.Errorf("the error contains the token: %s", err.Error())
+			}
+
+			if strings.Contains(buf.String(), c.token) {
+				t.Errorf("the log contains the token: %s", buf.String())
+			}
+		})
+	}
+}
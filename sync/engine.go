@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	engineNative = "native"
+	engineShell  = "shell"
+
+	// envLFSSkipSmudge keeps the lfs pointers when checking out, the lfs
+	// objects are copied inside obs and never downloaded.
+	envLFSSkipSmudge = "GIT_LFS_SKIP_SMUDGE=1"
+)
+
+// errSyncAborted is returned when the sync is aborted before it finishes,
+// and the files may be synced partially.
+var errSyncAborted = errors.New("the sync is aborted")
+
+// checkAbort returns errSyncAborted if abort is closed.
+func checkAbort(abort <-chan struct{}) error {
+	select {
+	case <-abort:
+		return errSyncAborted
+	default:
+		return nil
+	}
+}
+
+// LFSFile is a git lfs pointer file of repo. Size is the size of
+// lfs object, and it is 0 if unknown.
+type LFSFile struct {
+	Path string
+	SHA  string
+	Size int64
+}
+
+// SmallFile is a file uploaded to obs. MD5 is encoded by hex and
+// it is empty if unknown.
+type SmallFile struct {
+	Path string
+	Size int64
+	MD5  string
+}
+
+// CopiedFile is a renamed or copied file which is copied inside obs.
+// SHA is set if it is a lfs pointer file, and Size is the size of
+// lfs object or file.
+type CopiedFile struct {
+	Src  string
+	Dst  string
+	SHA  string
+	Size int64
+}
+
+// SyncResult is the result of syncing files of repo.
+type SyncResult struct {
+	LastCommit   string
+	LFSFiles     []LFSFile
+	SmallFiles   []SmallFile
+	CopiedFiles  []CopiedFile
+	DeletedFiles []string
+
+	// AddedFiles and ModifiedFiles are the number of regular files
+	// changed. They are 0 if unknown.
+	AddedFiles    int
+	ModifiedFiles int
+
+	// Mismatches is the result of verification after sync.
+	Mismatches []Mismatch
+}
+
+func (r *SyncResult) String() string {
+	return fmt.Sprintf(
+		"last commit=%s, lfs files=%d, small files=%d, copied files=%d, deleted files=%d",
+		r.LastCommit, len(r.LFSFiles), len(r.SmallFiles),
+		len(r.CopiedFiles), len(r.DeletedFiles),
+	)
+}
+
+type SyncOption struct {
+	// WorkDir is a temporary directory which will be removed after sync.
+	WorkDir  string
+	CloneURL string
+	// Env is the environment of git which supplies the credential.
+	// It is also needed after clone, because the blobs of partial clone
+	// are fetched on demand.
+	Env      []string
+	RepoName string
+	// Branch is the branch or tag to sync. It is the default branch if empty.
+	Branch string
+	// OBSPath is the obs path of repo, like repo_path/user/repo_id
+	OBSPath     string
+	StartCommit string
+	// Abort is closed when the sync must stop writing obs, because the
+	// lock may have been taken over. The file being written is finished.
+	Abort <-chan struct{}
+}
+
+// SyncEngine syncs the files changed after StartCommit to obs except
+// the lfs files which are only returned and should be copied by caller.
+// All the files will be synced if StartCommit is empty.
+type SyncEngine interface {
+	Sync(*SyncOption) (SyncResult, error)
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	gitStatusAdded    = 'A'
+	gitStatusCopied   = 'C'
+	gitStatusDeleted  = 'D'
+	gitStatusModified = 'M'
+	gitStatusRenamed  = 'R'
+	gitStatusTypeChg  = 'T'
+)
+
+// gitChange is a changed file between two commits.
+// Src is only set for renamed and copied file.
+type gitChange struct {
+	status  byte
+	oldMode string
+	newMode string
+	oldSHA  string
+	newSHA  string
+	src     string
+	path    string
+}
+
+// isRegular checks whether the file of mode is a regular file.
+// Symlink(120000) and submodule(160000) are not.
+func isRegular(mode string) bool {
+	return strings.HasPrefix(mode, "100")
+}
+
+func (c *gitChange) isExactSame() bool {
+	return c.oldSHA == c.newSHA && isRegular(c.oldMode) && isRegular(c.newMode)
+}
+
+// parseRawDiff parses the output of `git diff --raw -z --no-abbrev`.
+// Each item is like:
+// :oldmode newmode oldsha newsha status\0path\0
+// :oldmode newmode oldsha newsha R100\0src\0dst\0
+func parseRawDiff(v []byte) ([]gitChange, error) {
+	items := strings.Split(string(v), "\x00")
+
+	r := []gitChange{}
+
+	for i := 0; i < len(items); {
+		meta := items[i]
+		if meta == "" {
+			i++
+
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if !strings.HasPrefix(meta, ":") || len(fields) != 5 || fields[4] == "" {
+			return nil, fmt.Errorf("invalid raw diff: %s", meta)
+		}
+
+		c := gitChange{
+			status:  fields[4][0],
+			oldMode: fields[0],
+			newMode: fields[1],
+			oldSHA:  fields[2],
+			newSHA:  fields[3],
+		}
+
+		n := 1
+		if c.status == gitStatusRenamed || c.status == gitStatusCopied {
+			n = 2
+		}
+
+		if i+n >= len(items) {
+			return nil, fmt.Errorf("invalid raw diff: missing path of %s", meta)
+		}
+
+		if n == 2 {
+			c.src = items[i+1]
+		}
+		c.path = items[i+n]
+
+		r = append(r, c)
+
+		i += n + 1
+	}
+
+	return r, nil
+}
+
+// parseLsTree parses the output of `git ls-tree -r -z` as added files.
+// Each item is like: mode type sha\tpath\0
+func parseLsTree(v []byte) ([]gitChange, error) {
+	items := splitNul(v)
+
+	r := make([]gitChange, 0, len(items))
+
+	for _, item := range items {
+		i := strings.Index(item, "\t")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid ls-tree: %s", item)
+		}
+
+		fields := strings.Fields(item[:i])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid ls-tree: %s", item)
+		}
+
+		r = append(r, gitChange{
+			status:  gitStatusAdded,
+			newMode: fields[0],
+			newSHA:  fields[2],
+			path:    item[i+1:],
+		})
+	}
+
+	return r, nil
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testZeroSHA = "0000000000000000000000000000000000000000"
+	testSHA1    = "1111111111111111111111111111111111111111"
+	testSHA2    = "2222222222222222222222222222222222222222"
+)
+
+// rawDiff joins the items of `git diff --raw -z` output.
+func rawDiff(items ...string) []byte {
+	return []byte(strings.Join(items, "\x00") + "\x00")
+}
+
+func TestParseRawDiff(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   []byte
+		want    []gitChange
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			input: nil,
+			want:  []gitChange{},
+		},
+		{
+			name: "added modified deleted",
+			input: rawDiff(
+				":000000 100644 "+testZeroSHA+" "+testSHA1+" A", "a.txt",
+				":100644 100644 "+testSHA1+" "+testSHA2+" M", "dir/b.txt",
+				":100644 000000 "+testSHA2+" "+testZeroSHA+" D", "c.txt",
+			),
+			want: []gitChange{
+				{status: gitStatusAdded, oldMode: "000000", newMode: "100644", oldSHA: testZeroSHA, newSHA: testSHA1, path: "a.txt"},
+				{status: gitStatusModified, oldMode: "100644", newMode: "100644", oldSHA: testSHA1, newSHA: testSHA2, path: "dir/b.txt"},
+				{status: gitStatusDeleted, oldMode: "100644", newMode: "000000", oldSHA: testSHA2, newSHA: testZeroSHA, path: "c.txt"},
+			},
+		},
+		{
+			name: "renamed and copied with score",
+			input: rawDiff(
+				":100644 100644 "+testSHA1+" "+testSHA1+" R100", "old.txt", "new.txt",
+				":100644 100644 "+testSHA1+" "+testSHA2+" R086", "a/x.txt", "b/x.txt",
+				":100644 100644 "+testSHA1+" "+testSHA1+" C075", "src.txt", "dst.txt",
+			),
+			want: []gitChange{
+				{status: gitStatusRenamed, oldMode: "100644", newMode: "100644", oldSHA: testSHA1, newSHA: testSHA1, src: "old.txt", path: "new.txt"},
+				{status: gitStatusRenamed, oldMode: "100644", newMode: "100644", oldSHA: testSHA1, newSHA: testSHA2, src: "a/x.txt", path: "b/x.txt"},
+				{status: gitStatusCopied, oldMode: "100644", newMode: "100644", oldSHA: testSHA1, newSHA: testSHA1, src: "src.txt", path: "dst.txt"},
+			},
+		},
+		{
+			name: "mode changes",
+			input: rawDiff(
+				":100644 100755 "+testSHA1+" "+testSHA1+" M", "run.sh",
+				":100644 120000 "+testSHA1+" "+testSHA2+" T", "link",
+			),
+			want: []gitChange{
+				{status: gitStatusModified, oldMode: "100644", newMode: "100755", oldSHA: testSHA1, newSHA: testSHA1, path: "run.sh"},
+				{status: gitStatusTypeChg, oldMode: "100644", newMode: "120000", oldSHA: testSHA1, newSHA: testSHA2, path: "link"},
+			},
+		},
+		{
+			name: "paths with spaces and newlines",
+			input: rawDiff(
+				":000000 100644 "+testZeroSHA+" "+testSHA1+" A", "dir name/a b.txt",
+				":100644 100644 "+testSHA1+" "+testSHA1+" R100", "line\nbreak.txt", "new\nline.txt",
+			),
+			want: []gitChange{
+				{status: gitStatusAdded, oldMode: "000000", newMode: "100644", oldSHA: testZeroSHA, newSHA: testSHA1, path: "dir name/a b.txt"},
+				{status: gitStatusRenamed, oldMode: "100644", newMode: "100644", oldSHA: testSHA1, newSHA: testSHA1, src: "line\nbreak.txt", path: "new\nline.txt"},
+			},
+		},
+		{
+			name:    "missing colon",
+			input:   rawDiff("100644 100644 "+testSHA1+" "+testSHA2+" M", "a.txt"),
+			wantErr: true,
+		},
+		{
+			name:    "missing fields",
+			input:   rawDiff(":100644 100644 "+testSHA1+" M", "a.txt"),
+			wantErr: true,
+		},
+		{
+			name:    "missing path",
+			input:   []byte(":100644 100644 " + testSHA1 + " " + testSHA2 + " M"),
+			wantErr: true,
+		},
+		{
+			name:    "missing destination of rename",
+			input:   []byte(":100644 100644 " + testSHA1 + " " + testSHA1 + " R100\x00old.txt"),
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseRawDiff(c.input)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseLsTree(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   []byte
+		want    []gitChange
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			input: nil,
+			want:  []gitChange{},
+		},
+		{
+			name: "files",
+			input: rawDiff(
+				"100644 blob "+testSHA1+"\ta.txt",
+				"100755 blob "+testSHA2+"\tbin/run.sh",
+				"120000 blob "+testSHA1+"\tlink",
+				"160000 commit "+testSHA2+"\tsubmodule",
+			),
+			want: []gitChange{
+				{status: gitStatusAdded, newMode: "100644", newSHA: testSHA1, path: "a.txt"},
+				{status: gitStatusAdded, newMode: "100755", newSHA: testSHA2, path: "bin/run.sh"},
+				{status: gitStatusAdded, newMode: "120000", newSHA: testSHA1, path: "link"},
+				{status: gitStatusAdded, newMode: "160000", newSHA: testSHA2, path: "submodule"},
+			},
+		},
+		{
+			name: "paths with spaces, tabs and newlines",
+			input: rawDiff(
+				"100644 blob "+testSHA1+"\tdir name/a b.txt",
+				"100644 blob "+testSHA2+"\ttab\there.txt",
+				"100644 blob "+testSHA1+"\tline\nbreak.txt",
+			),
+			want: []gitChange{
+				{status: gitStatusAdded, newMode: "100644", newSHA: testSHA1, path: "dir name/a b.txt"},
+				{status: gitStatusAdded, newMode: "100644", newSHA: testSHA2, path: "tab\there.txt"},
+				{status: gitStatusAdded, newMode: "100644", newSHA: testSHA1, path: "line\nbreak.txt"},
+			},
+		},
+		{
+			name:    "missing tab",
+			input:   rawDiff("100644 blob " + testSHA1 + " a.txt"),
+			wantErr: true,
+		},
+		{
+			name:    "missing fields",
+			input:   rawDiff("100644 " + testSHA1 + "\ta.txt"),
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseLsTree(c.input)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %+v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
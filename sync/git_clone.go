@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const envLiteralPathspecs = "GIT_LITERAL_PATHSPECS=1"
+
+// clone returns the directory and the last commit of repo, and done must
+// be called after the repo is used. The repo is a worktree of the cached
+// mirror if the mirror cache is enabled, otherwise it is a shallow and
+// blobless clone which only has the start commit and the last commit.
+// The files are checked out on demand.
+// The StartCommit of opt is cleared if it is gone from the remote, such as
+// the branch has been force pushed and the remote has been gc-ed, so that
+// all the files are synced.
+func (e *nativeEngine) clone(opt *SyncOption) (string, string, func(), error) {
+	if e.mirrors != nil {
+		return e.cloneFromMirror(opt)
+	}
+
+	repoDir := filepath.Join(opt.WorkDir, opt.RepoName)
+
+	params := []string{
+		"clone", "-q", "--filter=blob:none", "--no-checkout", "--depth=1",
+	}
+	if opt.Branch != "" {
+		params = append(params, "--branch", opt.Branch)
+	}
+
+	params = append(params, opt.CloneURL, repoDir)
+
+	if _, err := runGitWithEnv(opt.Env, opt.WorkDir, params...); err != nil {
+		return "", "", nil, err
+	}
+
+	v, err := runGit(repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if opt.StartCommit != "" {
+		err := e.fetchCommit(repoDir, opt.Env, opt.StartCommit)
+		if err != nil && !e.skipMissingCommit(opt, err) {
+			return "", "", nil, err
+		}
+	}
+
+	return repoDir, strings.TrimSpace(string(v)), func() {}, nil
+}
+
+// cloneFromMirror adds a worktree of the mirror which is locked until
+// the worktree is done.
+func (e *nativeEngine) cloneFromMirror(opt *SyncOption) (string, string, func(), error) {
+	m := e.mirrors.acquire(opt.CloneURL)
+
+	repoDir, last, err := e.addWorktree(m, opt)
+	if err != nil {
+		e.mirrors.release(m)
+
+		return "", "", nil, err
+	}
+
+	done := func() {
+		if _, err := runGit(m.dir, "worktree", "remove", "--force", repoDir); err != nil {
+			e.log.Warnf("remove worktree %s failed, err:%s", repoDir, err.Error())
+		}
+
+		e.mirrors.release(m)
+	}
+
+	return repoDir, last, done, nil
+}
+
+func (e *nativeEngine) addWorktree(m *mirror, opt *SyncOption) (string, string, error) {
+	last, err := e.mirrors.update(m, opt)
+	if err != nil {
+		return "", "", err
+	}
+
+	// clean the worktrees which were not removed.
+	if _, err := runGit(m.dir, "worktree", "prune"); err != nil {
+		return "", "", err
+	}
+
+	repoDir := filepath.Join(opt.WorkDir, opt.RepoName)
+
+	_, err = runGit(
+		m.dir, "worktree", "add", "-q", "--detach", "--no-checkout", repoDir, last,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	if opt.StartCommit != "" {
+		err := checkCommit(repoDir, opt.Env, opt.StartCommit)
+		if err != nil && !e.skipMissingCommit(opt, err) {
+			return "", "", err
+		}
+	}
+
+	return repoDir, last, nil
+}
+
+// fetchCommit fetches the commit alone into the shallow clone, so that
+// its tree can be diffed with the last commit.
+func (e *nativeEngine) fetchCommit(repoDir string, env []string, commit string) error {
+	e.log.Debugf("fetch commit %s of %s", commit, repoDir)
+
+	_, err := runGitWithEnv(
+		env, repoDir, "fetch", "-q", "--depth=1", "--filter=blob:none", "origin", commit,
+	)
+
+	return err
+}
+
+// checkCommit checks the commit in the worktree of mirror. It is not fetched
+// with depth which would make the mirror shallow. The commit missing from
+// the mirror, such as the branch has been force pushed, is fetched lazily
+// from the promisor remote.
+func checkCommit(repoDir string, env []string, commit string) error {
+	_, err := runGitWithEnv(env, repoDir, "cat-file", "-e", commit+"^{commit}")
+
+	return err
+}
+
+// skipMissingCommit clears the start commit if the err means that it is
+// missing from the remote. The files deleted after it are not deleted from
+// obs by the full sync, and they are left to reconcile.
+func (e *nativeEngine) skipMissingCommit(opt *SyncOption, err error) bool {
+	if !isCommitMissing(err) {
+		return false
+	}
+
+	e.log.Warnf(
+		"start commit %s of %s is missing, sync all the files, err:%s",
+		opt.StartCommit, opt.OBSPath, err.Error(),
+	)
+
+	opt.StartCommit = ""
+
+	return true
+}
+
+// isCommitMissing checks the output of git which fetches a commit that is
+// not reachable from any ref of remote. The commit missing from the mirror
+// is also fetched from the remote lazily, so the output is the same.
+func isCommitMissing(err error) bool {
+	v := err.Error()
+
+	return strings.Contains(v, "not our ref") ||
+		strings.Contains(v, "unadvertised object")
+}
+
+// checkout checks out the files of commit, and their blobs are fetched
+// in batch.
+func (e *nativeEngine) checkout(repoDir string, env []string, commit string, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	// the pathspec file is out of repo so that it is not synced.
+	f, err := ioutil.TempFile(filepath.Dir(repoDir), "pathspec")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(strings.Join(files, "\x00"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = runGitWithEnv(
+		append([]string{envLiteralPathspecs}, env...), repoDir,
+		"checkout", "-q", commit,
+		"--pathspec-from-file="+f.Name(), "--pathspec-file-nul",
+	)
+
+	return err
+}
+
+// changedPaths returns the regular files which need to be checked out.
+func changedPaths(changes []gitChange) []string {
+	r := make([]string, 0, len(changes))
+
+	for i := range changes {
+		c := &changes[i]
+
+		if c.status != gitStatusDeleted && isRegular(c.newMode) {
+			r = append(r, c.path)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(
+		os.Environ(),
+		"GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@a",
+		"GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@a",
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v, %s", args[0], err, out)
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// newForcePushedRemote returns the url of a remote whose branch has been
+// force pushed and gc-ed, and the commit which is gone from it.
+func newForcePushedRemote(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	remote := filepath.Join(dir, "remote.git")
+
+	git(t, dir, "init", "-q", src)
+
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	git(t, src, "add", "a")
+	git(t, src, "commit", "-q", "-m", "1")
+	gone := git(t, src, "rev-parse", "HEAD")
+
+	git(t, src, "commit", "-q", "--amend", "-m", "2")
+
+	// only the reachable objects are cloned by the url of file.
+	git(t, dir, "clone", "-q", "--bare", "file://"+src, remote)
+	git(t, remote, "config", "uploadpack.allowFilter", "true")
+	git(t, remote, "config", "uploadpack.allowAnySHA1InWant", "true")
+
+	return "file://" + remote, gone
+}
+
+func TestCloneWithMissingStartCommit(t *testing.T) {
+	cloneURL, gone := newForcePushedRemote(t)
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	cases := []struct {
+		name   string
+		mirror bool
+	}{
+		{"shallow clone", false},
+		{"mirror", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var mirrors *mirrorCache
+			if c.mirror {
+				var err error
+				mirrors, err = newMirrorCache(filepath.Join(dir, "mirrors"), 0, logrus.NewEntry(log))
+				if err != nil {
+					t.Fatalf("new mirror cache: %v", err)
+				}
+			}
+
+			e := newNativeEngine(nil, &ServiceConfig{WorkDir: dir}, mirrors, logrus.NewEntry(log))
+
+			opt := SyncOption{
+				WorkDir:     dir,
+				CloneURL:    cloneURL,
+				RepoName:    "repo",
+				StartCommit: gone,
+			}
+
+			repoDir, last, done, err := e.clone(&opt)
+			if err != nil {
+				t.Fatalf("clone: %v", err)
+			}
+			defer done()
+
+			if opt.StartCommit != "" {
+				t.Fatalf("the missing start commit is not cleared: %s", opt.StartCommit)
+			}
+
+			changes, err := e.listChanges(repoDir, nil, opt.StartCommit, last)
+			if err != nil || len(changes) != 1 || changes[0].path != "a" {
+				t.Fatalf("list changes: %+v, %v", changes, err)
+			}
+		})
+	}
+}
+
+func TestIsCommitMissing(t *testing.T) {
+	cases := []struct {
+		output string
+		want   bool
+	}{
+		{"fatal: remote error: upload-pack: not our ref 0123", true},
+		{"error: Server does not allow request for unadvertised object 0123", true},
+		{"fatal: unable to access 'https://a/b.git/': Could not resolve host: a", false},
+		{"fatal: Authentication failed for 'https://a/b.git/'", false},
+	}
+
+	for _, c := range cases {
+		err := fmt.Errorf("run git fetch, err=exit status 128, output=%s", c.output)
+
+		if v := isCommitMissing(err); v != c.want {
+			t.Errorf("isCommitMissing(%q) = %v, want %v", c.output, v, c.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
+)
+
+// maxHistoryMismatches is the number of mismatches saved in the history.
+const maxHistoryMismatches = 100
+
+// failBeforeSync records the attempt which fails at stage before the files
+// are synced, and returns err.
+func (s *syncService) failBeforeSync(
+	info *RepoInfo, start time.Time, c *domain.RepoSyncLock, stage string, err error,
+) error {
+	metrics.SyncsFailed.WithLabelValues(stage).Inc()
+
+	s.saveHistory(info, start, c.LastCommit, &SyncResult{}, err)
+
+	return err
+}
+
+// skipSync records the push which is not synced because the repo is
+// blocked, so that it can be found and synced after unblocking.
+func (s *syncService) skipSync(info *RepoInfo, start time.Time, c *domain.RepoSyncLock) {
+	s.log.Warnf("skip the sync of repo(%s) which is blocked", info.String())
+
+	h := domain.SyncHistory{
+		Owner:      info.Owner,
+		RepoId:     info.RepoId,
+		Ref:        info.Ref,
+		StartTime:  start.Unix(),
+		EndTime:    time.Now().Unix(),
+		FromCommit: c.LastCommit,
+		Outcome:    domain.SyncOutcomeSkipped,
+		Error:      errRepoBlocked.Error(),
+	}
+
+	s.addHistory(info, &h)
+}
+
+// saveHistory records the attempt to sync repo. r may be partial if it fails.
+func (s *syncService) saveHistory(
+	info *RepoInfo, start time.Time, from string, r *SyncResult, err error,
+) {
+	h := domain.SyncHistory{
+		Owner:      info.Owner,
+		RepoId:     info.RepoId,
+		Ref:        info.Ref,
+		StartTime:  start.Unix(),
+		EndTime:    time.Now().Unix(),
+		FromCommit: from,
+		ToCommit:   r.LastCommit,
+		Added:      r.AddedFiles,
+		Modified:   r.ModifiedFiles,
+		Deleted:    len(r.DeletedFiles),
+		LFSCopied:  len(r.LFSFiles),
+		Outcome:    domain.SyncOutcomeSucceeded,
+	}
+
+	for i := range r.CopiedFiles {
+		if r.CopiedFiles[i].SHA != "" {
+			h.LFSCopied++
+		}
+	}
+
+	for i := range r.SmallFiles {
+		h.Bytes += r.SmallFiles[i].Size
+	}
+
+	h.Mismatches = toHistoryMismatches(r.Mismatches)
+
+	if err != nil {
+		h.Outcome = domain.SyncOutcomeFailed
+		h.Error = truncateError(err)
+	}
+
+	s.addHistory(info, &h)
+}
+
+func (s *syncService) addHistory(info *RepoInfo, h *domain.SyncHistory) {
+	if err := s.history.Add(h); err != nil {
+		s.log.Errorf(
+			"save sync history of repo(%s) failed, err:%s",
+			info.String(), err.Error(),
+		)
+	}
+}
+
+// toHistoryMismatches keeps the first maxHistoryMismatches mismatches, and
+// the number of the rest.
+func toHistoryMismatches(ms []Mismatch) []string {
+	n := len(ms)
+	if n > maxHistoryMismatches {
+		n = maxHistoryMismatches
+	}
+
+	r := make([]string, 0, n+1)
+	for i := 0; i < n; i++ {
+		r = append(r, ms[i].String())
+	}
+
+	if len(ms) > n {
+		r = append(r, fmt.Sprintf("and %d more", len(ms)-n))
+	}
+
+	return r
+}
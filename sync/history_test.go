@@ -0,0 +1,64 @@
+package sync
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+)
+
+type blockedLock struct {
+	synclock.RepoSyncLock
+}
+
+func (l blockedLock) Find(owner domain.Account, repoId, ref string) (domain.RepoSyncLock, error) {
+	return domain.RepoSyncLock{
+		Owner:      owner,
+		RepoId:     repoId,
+		Ref:        ref,
+		Status:     domain.RepoSyncStatusBlocked,
+		LastCommit: "c1",
+	}, nil
+}
+
+type memHistory struct {
+	synchistory.SyncHistory
+
+	v []domain.SyncHistory
+}
+
+func (h *memHistory) Add(v *domain.SyncHistory) error {
+	h.v = append(h.v, *v)
+
+	return nil
+}
+
+func TestSyncBlockedRepo(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	h := &memHistory{}
+	s := &syncService{
+		log:     logrus.NewEntry(log),
+		lock:    blockedLock{},
+		history: h,
+	}
+
+	// it is not retried, but recorded.
+	if err := s.SyncRepo(testRepo("1", "repo")); err != nil {
+		t.Fatalf("sync blocked repo: %v", err)
+	}
+
+	if len(h.v) != 1 {
+		t.Fatalf("histories = %+v, want the skipped one", h.v)
+	}
+
+	v := h.v[0]
+	if v.Outcome != domain.SyncOutcomeSkipped || v.FromCommit != "c1" || v.Error == "" {
+		t.Fatalf("history = %+v", v)
+	}
+}
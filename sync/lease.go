@@ -0,0 +1,270 @@
+package sync
+
+import (
+	"errors"
+	"time"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
+)
+
+const stuckLocksPageSize = 500
+
+var (
+	errRepoBlocked = errors.New("the sync of repo is blocked, it must be unblocked first")
+	errLeaseLost   = errors.New("the lease of sync lock can't be renewed, the sync is aborted")
+)
+
+// errorRepoBusy means the repo is being synced by others. The sync should
+// be tried later, but it is not a failure of the sync.
+type errorRepoBusy struct {
+	error
+}
+
+func IsRepoBusy(err error) bool {
+	_, ok := err.(errorRepoBusy)
+
+	return ok
+}
+
+// findLock returns the lock of repo and whether it should be taken over.
+// It fails with errorRepoBusy if the repo is being synced by others.
+func (s *syncService) findLock(info *RepoInfo) (c domain.RepoSyncLock, takeover bool, err error) {
+	c, err = s.lock.Find(info.Owner, info.RepoId, info.Ref)
+	if err != nil {
+		if !synclock.IsRepoSyncLockNotExist(err) {
+			return
+		}
+
+		err = nil
+		c.Owner = info.Owner
+		c.RepoId = info.RepoId
+		c.Ref = info.Ref
+	}
+
+	if c.IsBlocked() {
+		err = errRepoBlocked
+
+		return
+	}
+
+	if c.IsRunning() {
+		if !c.IsExpired(time.Now().Unix()) {
+			err = errorRepoBusy{errors.New("repo is being synced by " + c.Holder)}
+
+			return
+		}
+
+		takeover = true
+	}
+
+	return
+}
+
+func (s *syncService) acquireLock(c *domain.RepoSyncLock, info *RepoInfo, takeover bool) (
+	domain.RepoSyncLock, error,
+) {
+	holder := c.Holder
+
+	if err := c.Start(s.cfg.InstanceId, s.leaseExpiry()); err != nil {
+		return *c, err
+	}
+
+	v, err := s.lock.Save(c)
+	if err != nil {
+		// the other one has started the sync.
+		if synclock.IsConcurrentUpdating(err) {
+			err = errorRepoBusy{err}
+		}
+
+		return v, err
+	}
+
+	if takeover {
+		metrics.LockTakeovers.Inc()
+
+		s.log.Warnf(
+			"take over the expired sync lock of repo(%s) held by %s",
+			info.String(), holder,
+		)
+	}
+
+	return v, nil
+}
+
+// releaseLock finishes the running sync with its result. The repo is
+// blocked if it fails too many times consecutively.
+func (s *syncService) releaseLock(
+	c *domain.RepoSyncLock, info *RepoInfo, lastCommit string, syncErr error,
+) {
+	var err error
+	if syncErr == nil {
+		err = c.Succeed(lastCommit)
+	} else {
+		p := s.cfg.policy(c.RepoType)
+		err = c.Fail(truncateError(syncErr), p.maxFailures())
+	}
+
+	if err != nil {
+		s.log.Errorf("finish the sync of repo(%s) failed, err:%s", info.String(), err.Error())
+
+		return
+	}
+
+	if c.IsBlocked() {
+		s.log.Warnf(
+			"the sync of repo(%s) is blocked after %d consecutive failures",
+			info.String(), c.Failures,
+		)
+	}
+
+	// the lock has been taken over if it is changed by the others,
+	// and it can't be saved by retrying.
+	conflict := false
+
+	err = retry(func() error {
+		_, err := s.lock.Save(c)
+		if err != nil {
+			s.log.Errorf(
+				"save sync repo(%s) failed, err:%s, value=%v",
+				info.String(), err.Error(), *c,
+			)
+
+			if synclock.IsConcurrentUpdating(err) {
+				conflict = true
+
+				return nil
+			}
+		}
+
+		return err
+	})
+	if conflict {
+		metrics.SyncsFailed.WithLabelValues(metrics.StageUnlock).Inc()
+
+		s.log.Warnf(
+			"the sync lock of repo(%s) has been taken over, the result is dropped",
+			info.String(),
+		)
+
+		return
+	}
+
+	if err != nil {
+		metrics.SyncsFailed.WithLabelValues(metrics.StageUnlock).Inc()
+
+		s.log.Errorf(
+			"save sync repo(%s) failed, the lock will be taken over after it expires",
+			info.String(),
+		)
+	}
+}
+
+// CountStuckLocks counts the running locks whose lease expires.
+func CountStuckLocks(l synclock.RepoSyncLock) (int, error) {
+	now := time.Now().Unix()
+	opt := synclock.ListOption{
+		Status: domain.RepoSyncStatusRunning.RepoSyncStatus(),
+		Limit:  stuckLocksPageSize,
+	}
+
+	n := 0
+
+	for {
+		v, err := l.List(&opt)
+		if err != nil {
+			return 0, err
+		}
+
+		for i := range v {
+			if v[i].IsExpired(now) {
+				n++
+			}
+		}
+
+		if len(v) < opt.Limit {
+			return n, nil
+		}
+
+		opt.Offset += len(v)
+	}
+}
+
+func (s *syncService) leaseExpiry() int64 {
+	return time.Now().Add(s.lease).Unix()
+}
+
+// keepLease renews the lease of running sync periodically until stop is
+// called, and c must not be accessed before that. lost is closed if the
+// lease can't be renewed, then the sync must be aborted and the lock must
+// not be released, because it may have been taken over by the others.
+// The failed renewal is retried until the lease is about to expire unless
+// the lock has been changed by the others.
+func (s *syncService) keepLease(c *domain.RepoSyncLock, info *RepoInfo) (
+	func(), <-chan struct{},
+) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	lost := make(chan struct{})
+
+	interval := s.lease / 3
+	retryInterval := s.lease / 30
+	margin := s.lease / 10
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTimer(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+
+			case <-t.C:
+			}
+
+			v := *c
+			v.Expiry = s.leaseExpiry()
+
+			r, err := s.lock.Save(&v)
+			if err == nil {
+				*c = r
+				t.Reset(interval)
+
+				continue
+			}
+
+			left := time.Until(time.Unix(c.Expiry, 0)) - margin
+
+			if synclock.IsConcurrentUpdating(err) || left <= 0 {
+				s.log.Errorf(
+					"renew the lease of sync repo(%s) failed, abort it, err:%s",
+					info.String(), err.Error(),
+				)
+
+				close(lost)
+
+				return
+			}
+
+			s.log.Warnf(
+				"renew the lease of sync repo(%s) failed, retry it, err:%s",
+				info.String(), err.Error(),
+			)
+
+			if left > retryInterval {
+				left = retryInterval
+			}
+
+			t.Reset(left)
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}, lost
+}
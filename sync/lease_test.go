@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"errors"
+	"io/ioutil"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+)
+
+// flakyLock fails to save the lock by the errors in order, and succeeds
+// after they are used up.
+type flakyLock struct {
+	synclock.RepoSyncLock
+
+	lock   gosync.Mutex
+	errs   []error
+	always error
+	saved  int
+}
+
+func (l *flakyLock) Save(c *domain.RepoSyncLock) (domain.RepoSyncLock, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.always != nil {
+		return *c, l.always
+	}
+
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+
+		return *c, err
+	}
+
+	l.saved++
+
+	return *c, nil
+}
+
+func newTestLeaseService(l synclock.RepoSyncLock) *syncService {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	return &syncService{
+		log:   logrus.NewEntry(log),
+		lock:  l,
+		lease: 3 * time.Second,
+	}
+}
+
+func TestKeepLease(t *testing.T) {
+	transient := errors.New("connection reset")
+
+	cases := []struct {
+		name string
+		lock *flakyLock
+		// wait is how long the sync runs.
+		wait time.Duration
+		lost bool
+	}{
+		{
+			name: "transient errors",
+			lock: &flakyLock{errs: []error{transient, transient, transient}},
+			wait: 2 * time.Second,
+		},
+		{
+			name: "taken over",
+			lock: &flakyLock{errs: []error{
+				synclock.NewErrorConcurrentUpdating(errors.New("no matched record")),
+			}},
+			wait: 1500 * time.Millisecond,
+			lost: true,
+		},
+		{
+			name: "lease expires",
+			lock: &flakyLock{always: transient},
+			wait: 3 * time.Second,
+			lost: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestLeaseService(c.lock)
+
+			owner, _ := domain.NewAccount("owner")
+			info := RepoInfo{Owner: owner, RepoId: "1"}
+			lock := domain.RepoSyncLock{Owner: owner, RepoId: "1", Expiry: s.leaseExpiry()}
+
+			stop, lost := s.keepLease(&lock, &info)
+
+			select {
+			case <-lost:
+				if !c.lost {
+					t.Fatal("the lease is lost")
+				}
+
+				if time.Now().Unix() >= lock.Expiry {
+					t.Fatal("the lease is lost after it expires")
+				}
+
+			case <-time.After(c.wait):
+				if c.lost {
+					t.Fatal("the lease is not lost")
+				}
+			}
+
+			stop()
+
+			if !c.lost && c.lock.saved == 0 {
+				t.Fatal("the lease is not renewed")
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package sync
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+)
+
+const (
+	deletePolicyDelete  = "delete"
+	deletePolicyArchive = "archive"
+)
+
+var errRepoSyncing = errors.New("repo is syncing")
+
+// LifecycleService applies the changes of repo on platform to the mirror
+// and the sync locks.
+type LifecycleService interface {
+	// DeleteRef removes the mirror of a deleted branch or tag.
+	DeleteRef(info *RepoInfo) error
+
+	// DeleteRepo removes the mirror of a deleted repo.
+	DeleteRepo(repoId string) error
+
+	// MoveRepo moves the mirror of repo which is transferred to owner.
+	MoveRepo(repoId string, owner domain.Account) error
+
+	// Run purges the expired trash periodically until Stop is called.
+	Run()
+	Stop()
+}
+
+func NewLifecycleService(
+	cfg *Config, log *logrus.Entry,
+	s obs.OBS,
+	l synclock.RepoSyncLock,
+) LifecycleService {
+	return &lifecycleService{
+		h: &syncHelper{
+			obsService: s,
+			cfg:        cfg.HelperConfig,
+		},
+		cfg:        cfg.LifecycleConfig,
+		log:        log,
+		lock:       l,
+		obsService: s,
+		holder:     cfg.InstanceId,
+		lease:      time.Duration(cfg.LeaseDuration) * time.Second,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+type lifecycleService struct {
+	h          *syncHelper
+	cfg        LifecycleConfig
+	log        *logrus.Entry
+	lock       synclock.RepoSyncLock
+	obsService obs.OBS
+
+	holder string
+	lease  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (s *lifecycleService) DeleteRef(info *RepoInfo) error {
+	c, err := s.lock.Find(info.Owner, info.RepoId, info.Ref)
+	if err != nil {
+		if !synclock.IsRepoSyncLockNotExist(err) {
+			return err
+		}
+
+		// it has never been synced.
+		return nil
+	}
+
+	info.Type = c.RepoType
+
+	locks, err := s.lockRefs(func() ([]domain.RepoSyncLock, error) {
+		return []domain.RepoSyncLock{c}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeObjects(s.h.getRepoObsPath(s.h.refOBSPath(info))); err != nil {
+		s.unlockRefs(locks)
+
+		return err
+	}
+
+	s.log.Infof("removed the mirror of %s", info.String())
+
+	return s.lock.Remove(&locks[0])
+}
+
+func (s *lifecycleService) DeleteRepo(repoId string) error {
+	locks, err := s.lockRefs(func() ([]domain.RepoSyncLock, error) {
+		return s.lock.FindByRepo(repoId)
+	})
+	if err != nil || len(locks) == 0 {
+		return err
+	}
+
+	for _, p := range s.repoOBSPaths(locks, nil) {
+		if err := s.removeObjects(p); err != nil {
+			s.unlockRefs(locks)
+
+			return err
+		}
+
+		s.log.Infof("removed the mirror of %s", p)
+	}
+
+	for i := range locks {
+		if err := s.lock.Remove(&locks[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *lifecycleService) MoveRepo(repoId string, owner domain.Account) error {
+	// only the refs which have not been moved are locked, because the
+	// earlier move may fail after some of them are moved.
+	locks, err := s.lockRefs(func() ([]domain.RepoSyncLock, error) {
+		v, err := s.lock.FindByRepo(repoId)
+		if err != nil {
+			return nil, err
+		}
+
+		r := make([]domain.RepoSyncLock, 0, len(v))
+		for i := range v {
+			if v[i].Owner.Account() != owner.Account() {
+				r = append(r, v[i])
+			}
+		}
+
+		return r, nil
+	})
+	if err != nil || len(locks) == 0 {
+		return err
+	}
+
+	from := s.repoOBSPaths(locks, nil)
+	to := s.repoOBSPaths(locks, owner)
+
+	for i := range from {
+		if from[i] == to[i] {
+			continue
+		}
+
+		if err := s.moveObjects(from[i], to[i]); err != nil {
+			s.unlockRefs(locks)
+
+			return err
+		}
+
+		s.log.Infof("moved the mirror of %s to %s", from[i], to[i])
+	}
+
+	for i := range locks {
+		old := &locks[i]
+
+		// the lock is moved with its result except the running sync.
+		c := *old
+		c.Id = ""
+		c.Owner = owner
+		c.Version = 0
+		c.Fence = 0
+
+		if c.IsRunning() {
+			if err := c.Abort(); err != nil {
+				return err
+			}
+		}
+
+		if _, err := s.lock.Save(&c); err != nil {
+			return err
+		}
+
+		if err := s.lock.Remove(old); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockRefs holds the locks returned by find, so that they will not be
+// synced during the change. It waits if any of them is syncing.
+func (s *lifecycleService) lockRefs(find func() ([]domain.RepoSyncLock, error)) (
+	[]domain.RepoSyncLock, error,
+) {
+	deadline := time.Now().Add(s.lease)
+
+	for {
+		locks, err := find()
+		if err != nil || len(locks) == 0 {
+			return nil, err
+		}
+
+		taken, err := s.tryLockRefs(locks)
+		if err == nil {
+			return taken, nil
+		}
+
+		if err != errRepoSyncing || time.Now().After(deadline) {
+			return nil, err
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (s *lifecycleService) tryLockRefs(locks []domain.RepoSyncLock) ([]domain.RepoSyncLock, error) {
+	now := time.Now().Unix()
+	taken := make([]domain.RepoSyncLock, 0, len(locks))
+
+	for i := range locks {
+		c := locks[i]
+
+		if c.IsRunning() && !c.IsExpired(now) {
+			s.unlockRefs(taken)
+
+			return nil, errRepoSyncing
+		}
+
+		// the blocked repo is not synced, so it needn't be locked.
+		if c.IsBlocked() {
+			taken = append(taken, c)
+
+			continue
+		}
+
+		if err := c.Start(s.holder, time.Now().Add(s.lease).Unix()); err != nil {
+			s.unlockRefs(taken)
+
+			return nil, err
+		}
+
+		v, err := s.lock.Save(&c)
+		if err != nil {
+			s.unlockRefs(taken)
+
+			return nil, err
+		}
+
+		taken = append(taken, v)
+	}
+
+	return taken, nil
+}
+
+func (s *lifecycleService) unlockRefs(locks []domain.RepoSyncLock) {
+	for i := range locks {
+		c := locks[i]
+		if !c.IsRunning() {
+			continue
+		}
+
+		if err := c.Abort(); err != nil {
+			s.log.Errorf("unlock repo(%s) failed, err:%s", c.RepoId, err.Error())
+
+			continue
+		}
+
+		if _, err := s.lock.Save(&c); err != nil {
+			s.log.Errorf(
+				"unlock repo(%s) failed, err:%s",
+				c.RepoId, err.Error(),
+			)
+		}
+	}
+}
+
+// repoOBSPaths returns the obs paths of the refs of repo. The owner of
+// locks will be replaced if owner is not nil.
+func (s *lifecycleService) repoOBSPaths(locks []domain.RepoSyncLock, owner domain.Account) []string {
+	r := make([]string, 0, len(locks))
+
+	for i := range locks {
+		info := RepoInfo{
+			Owner:  locks[i].Owner,
+			RepoId: locks[i].RepoId,
+			Ref:    locks[i].Ref,
+			Type:   locks[i].RepoType,
+		}
+		if owner != nil {
+			info.Owner = owner
+		}
+
+		r = append(r, s.h.getRepoObsPath(s.h.refOBSPath(&info)))
+	}
+
+	return r
+}
+
+func (s *lifecycleService) removeObjects(prefix string) error {
+	if s.cfg.DeletePolicy == deletePolicyArchive {
+		trash := filepath.Join(
+			s.cfg.TrashPath, strconv.FormatInt(time.Now().Unix(), 10), prefix,
+		)
+
+		return s.moveObjects(prefix, trash)
+	}
+
+	objs, err := s.obsService.ListObjects(prefix + "/")
+	if err != nil {
+		return err
+	}
+
+	for i := range objs {
+		p := objs[i].Path
+
+		if err := retry(func() error {
+			return s.obsService.DeleteObject(p)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *lifecycleService) moveObjects(from, to string) error {
+	objs, err := s.obsService.ListObjects(from + "/")
+	if err != nil {
+		return err
+	}
+
+	for i := range objs {
+		src := objs[i].Path
+		dst := filepath.Join(to, strings.TrimPrefix(src, from+"/"))
+
+		err := retry(func() error {
+			return s.obsService.CopyObject(dst, src)
+		})
+		if err == nil {
+			err = retry(func() error {
+				return s.obsService.DeleteObject(src)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *lifecycleService) Run() {
+	go func() {
+		defer close(s.done)
+
+		if s.cfg.DeletePolicy != deletePolicyArchive {
+			return
+		}
+
+		t := time.NewTicker(time.Hour)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+
+			case <-t.C:
+				if err := s.purgeTrash(); err != nil {
+					s.log.Errorf("purge trash failed, err:%s", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+func (s *lifecycleService) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// purgeTrash deletes the archived objects which are expired.
+// The path of archived object is like: trash_path/timestamp/xxx
+func (s *lifecycleService) purgeTrash() error {
+	prefix := s.cfg.TrashPath + "/"
+
+	objs, err := s.obsService.ListObjects(prefix)
+	if err != nil {
+		return err
+	}
+
+	expiry := time.Now().AddDate(0, 0, -s.cfg.TrashRetention).Unix()
+
+	for i := range objs {
+		p := objs[i].Path
+
+		ts := strings.SplitN(strings.TrimPrefix(p, prefix), "/", 2)[0]
+		if v, err := strconv.ParseInt(ts, 10, 64); err != nil || v > expiry {
+			continue
+		}
+
+		if err := s.obsService.DeleteObject(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mirrorCacheDir = "mirrors"
+
+	// mirrorTmpPrefix is the prefix of mirror being cloned.
+	mirrorTmpPrefix = ".tmp-"
+
+	// mirrorRefPrefix is the prefix of refs fetched into the mirror,
+	// which keeps the fetched commits from gc.
+	mirrorRefPrefix = "refs/sync/"
+)
+
+// mirror is a bare and blobless clone of repo. It is locked by mu when used.
+type mirror struct {
+	mu  sync.Mutex
+	dir string
+
+	// refs, size and used are protected by the lock of mirrorCache.
+	refs int
+	size int64
+	used time.Time
+
+	// checked is whether the mirror has been verified since loaded.
+	checked bool
+}
+
+// mirrorCache is the mirrors of repos under dir. The least recently used
+// mirrors are evicted when the total size exceeds the budget.
+type mirrorCache struct {
+	dir    string
+	budget int64
+	log    *logrus.Entry
+
+	mu      sync.Mutex
+	mirrors map[string]*mirror
+}
+
+func newMirrorCache(dir string, budget int64, log *logrus.Entry) (*mirrorCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	items, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mirrorCache{
+		dir:     dir,
+		budget:  budget,
+		log:     log,
+		mirrors: make(map[string]*mirror, len(items)),
+	}
+
+	for _, item := range items {
+		p := filepath.Join(dir, item.Name())
+
+		// remove the mirror which was not cloned completely.
+		if !item.IsDir() || strings.HasPrefix(item.Name(), mirrorTmpPrefix) {
+			if err := os.RemoveAll(p); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		size, err := dirSize(p)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mirrors[item.Name()] = &mirror{dir: p, size: size, used: item.ModTime()}
+	}
+
+	return c, nil
+}
+
+// acquire locks the mirror of repo exclusively.
+func (c *mirrorCache) acquire(cloneURL string) *mirror {
+	v := sha256.Sum256([]byte(cloneURL))
+	key := hex.EncodeToString(v[:16])
+
+	c.mu.Lock()
+
+	m, ok := c.mirrors[key]
+	if !ok {
+		m = &mirror{dir: filepath.Join(c.dir, key)}
+		c.mirrors[key] = m
+	}
+	m.refs++
+
+	c.mu.Unlock()
+
+	m.mu.Lock()
+
+	return m
+}
+
+// release unlocks the mirror and evicts the mirrors if necessary.
+func (c *mirrorCache) release(m *mirror) {
+	size, err := dirSize(m.dir)
+	if err != nil && !os.IsNotExist(err) {
+		c.log.Warnf("get size of mirror %s failed, err:%s", m.dir, err.Error())
+	}
+
+	m.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m.refs--
+	m.used = time.Now()
+	if err == nil {
+		m.size = size
+	}
+
+	c.evict()
+}
+
+// evict removes the least recently used mirrors which are not in use
+// until the total size is within the budget.
+func (c *mirrorCache) evict() {
+	total := int64(0)
+	for _, m := range c.mirrors {
+		total += m.size
+	}
+
+	for total > c.budget {
+		key := ""
+		var lru *mirror
+
+		for k, m := range c.mirrors {
+			if m.refs == 0 && (lru == nil || m.used.Before(lru.used)) {
+				key, lru = k, m
+			}
+		}
+
+		if lru == nil {
+			return
+		}
+
+		c.log.Infof("evict mirror %s of %d bytes", lru.dir, lru.size)
+
+		if err := os.RemoveAll(lru.dir); err != nil {
+			c.log.Errorf("remove mirror %s failed, err:%s", lru.dir, err.Error())
+
+			return
+		}
+
+		delete(c.mirrors, key)
+		total -= lru.size
+	}
+}
+
+// update fetches the ref to sync into the mirror and returns its commit.
+// The mirror is cloned again if it does not exist or is corrupted.
+func (c *mirrorCache) update(m *mirror, opt *SyncOption) (string, error) {
+	if _, err := os.Stat(m.dir); err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if err := c.create(m, opt); err != nil {
+			return "", err
+		}
+	} else if !m.checked {
+		if err := c.verify(m, opt); err != nil {
+			return "", err
+		}
+	}
+
+	src, ref := "HEAD", mirrorRefPrefix+"HEAD"
+	if opt.Branch != "" {
+		src, ref = opt.Branch, mirrorRefPrefix+opt.Branch
+	}
+
+	fetch := func() error {
+		_, err := runGitWithEnv(opt.Env, m.dir, "fetch", "-q", "origin", "+"+src+":"+ref)
+
+		return err
+	}
+
+	if err := fetch(); err != nil {
+		// it may be a network error which can't be fixed by cloning again.
+		if _, ferr := runGit(m.dir, "fsck", "--connectivity-only", "--no-progress"); ferr == nil {
+			return "", err
+		}
+
+		c.log.Warnf("mirror %s is corrupted, clone it again, err:%s", m.dir, err.Error())
+
+		if err = c.create(m, opt); err != nil {
+			return "", err
+		}
+
+		if err = fetch(); err != nil {
+			return "", err
+		}
+	}
+
+	v, err := runGit(m.dir, "rev-parse", ref)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(v)), nil
+}
+
+// verify checks the mirror loaded from disk, and clones it again if it
+// is corrupted.
+func (c *mirrorCache) verify(m *mirror, opt *SyncOption) error {
+	_, err := runGit(m.dir, "fsck", "--connectivity-only", "--no-progress")
+	if err == nil {
+		m.checked = true
+
+		return nil
+	}
+
+	c.log.Warnf("mirror %s is corrupted, clone it again, err:%s", m.dir, err.Error())
+
+	return c.create(m, opt)
+}
+
+// create clones the mirror into a temporary directory and renames it,
+// so that an incomplete mirror is never used.
+func (c *mirrorCache) create(m *mirror, opt *SyncOption) error {
+	if err := os.RemoveAll(m.dir); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(c.dir, mirrorTmpPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = runGitWithEnv(
+		opt.Env, c.dir, "clone", "-q", "--bare", "--filter=blob:none",
+		opt.CloneURL, tmp,
+	)
+	if err == nil {
+		err = os.Rename(tmp, m.dir)
+	}
+
+	if err != nil {
+		os.RemoveAll(tmp)
+
+		return err
+	}
+
+	m.checked = true
+
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	size := int64(0)
+
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,466 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+const (
+	// the size of lfs pointer file must be less than 1024 bytes
+	lfsPointerMaxSize = 1024
+
+	checkpointDir = "checkpoints"
+)
+
+var (
+	reLFSVersion = regexp.MustCompile("^version https://(git-lfs|hawser)\\.github\\.com/spec/v1$")
+	reLFSOid     = regexp.MustCompile("^oid sha256:([0-9a-f]{64})$")
+	reLFSSize    = regexp.MustCompile("^size ([0-9]+)$")
+)
+
+func newNativeEngine(
+	s obs.OBS, cfg *ServiceConfig, mirrors *mirrorCache, log *logrus.Entry,
+) *nativeEngine {
+	return &nativeEngine{
+		obsService:    s,
+		largeFileSize: cfg.LargeFileSize,
+		multipartSize: cfg.MultipartSize,
+		checkpointDir: filepath.Join(cfg.WorkDir, checkpointDir),
+		workers:       cfg.UploadWorkers,
+		bandwidth:     utils.NewRateLimiter(cfg.UploadBandwidth),
+		mirrors:       mirrors,
+		log:           log,
+	}
+}
+
+type nativeEngine struct {
+	obsService    obs.OBS
+	largeFileSize int64
+
+	// the files not smaller than multipartSize are uploaded by multipart,
+	// and the checkpoints of uploads are saved under checkpointDir.
+	multipartSize int64
+	checkpointDir string
+
+	// workers is the number of files synced concurrently, and bandwidth
+	// is shared by all the syncs.
+	workers   int
+	bandwidth *utils.RateLimiter
+
+	// mirrors is nil if the mirror cache is disabled.
+	mirrors *mirrorCache
+	log     *logrus.Entry
+}
+
+// syncPlan is the operations to sync the changed files.
+// The copies must be done before deletes, because the source of
+// renamed file will be deleted.
+type syncPlan struct {
+	copies  []CopiedFile
+	deletes []string
+	uploads []string
+	lfs     []LFSFile
+
+	// blobs is the sha of git blob of the files, which identifies the
+	// content of the resumed upload.
+	blobs map[string]string
+
+	added    int
+	modified int
+}
+
+func (e *nativeEngine) Sync(opt *SyncOption) (r SyncResult, err error) {
+	repoDir, last, done, err := e.clone(opt)
+	if err != nil {
+		return
+	}
+	defer done()
+
+	r.LastCommit = last
+
+	changes, err := e.listChanges(repoDir, opt.Env, opt.StartCommit, r.LastCommit)
+	if err != nil {
+		return
+	}
+
+	if err = e.checkout(repoDir, opt.Env, r.LastCommit, changedPaths(changes)); err != nil {
+		return
+	}
+
+	p, err := e.plan(repoDir, changes)
+	if err != nil {
+		return
+	}
+
+	if err = e.copy(opt.OBSPath, &p, &r, opt.Abort); err != nil {
+		return
+	}
+
+	err = utils.Parallel(e.workers, len(p.deletes), func(i int) error {
+		if err := checkAbort(opt.Abort); err != nil {
+			return err
+		}
+
+		return e.delete(opt.OBSPath, p.deletes[i])
+	})
+	if err != nil {
+		return
+	}
+	r.DeletedFiles = p.deletes
+
+	r.SmallFiles = make([]SmallFile, len(p.uploads))
+
+	err = utils.Parallel(e.workers, len(p.uploads), func(i int) (err error) {
+		if err = checkAbort(opt.Abort); err != nil {
+			return
+		}
+
+		f := p.uploads[i]
+		r.SmallFiles[i], err = e.upload(repoDir, opt.OBSPath, f, p.blobs[f])
+
+		return
+	})
+	if err != nil {
+		return
+	}
+	r.LFSFiles = p.lfs
+	r.AddedFiles = p.added
+	r.ModifiedFiles = p.modified
+
+	return
+}
+
+func (e *nativeEngine) listChanges(repoDir string, env []string, start, last string) ([]gitChange, error) {
+	if start == "" {
+		v, err := runGit(repoDir, "ls-tree", "-r", "-z", "--full-tree", last)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseLsTree(v)
+	}
+
+	// the blobs may be fetched to detect the renames.
+	v, err := runGitWithEnv(
+		env, repoDir, "diff", "--raw", "-z", "--no-abbrev", "-M", "-C",
+		start+".."+last,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRawDiff(v)
+}
+
+func (e *nativeEngine) plan(repoDir string, changes []gitChange) (p syncPlan, err error) {
+	p.blobs = map[string]string{}
+
+	// the files which will be written, they can't be the source of copy.
+	written := map[string]bool{}
+	for i := range changes {
+		if isRegular(changes[i].newMode) {
+			written[changes[i].path] = true
+		}
+	}
+
+	deleted := map[string]bool{}
+	deleteFile := func(f string) {
+		if !written[f] && !deleted[f] {
+			deleted[f] = true
+			p.deletes = append(p.deletes, f)
+		}
+	}
+
+	for i := range changes {
+		c := &changes[i]
+
+		switch c.status {
+		case gitStatusDeleted:
+			if isRegular(c.oldMode) {
+				deleteFile(c.path)
+			}
+
+			continue
+
+		case gitStatusRenamed:
+			if isRegular(c.oldMode) {
+				deleteFile(c.src)
+			}
+
+		case gitStatusTypeChg:
+			if isRegular(c.oldMode) && !isRegular(c.newMode) {
+				deleteFile(c.path)
+			}
+		}
+
+		// symlink and submodule are not synced.
+		if !isRegular(c.newMode) {
+			e.log.Debugf("skip non-regular file: %s", c.path)
+
+			continue
+		}
+
+		p.blobs[c.path] = c.newSHA
+
+		if c.status == gitStatusModified || c.status == gitStatusTypeChg {
+			p.modified++
+		} else {
+			p.added++
+		}
+
+		copyable := (c.status == gitStatusRenamed || c.status == gitStatusCopied) &&
+			c.isExactSame() && !written[c.src]
+
+		if err = e.planFile(repoDir, c, copyable, &p); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (e *nativeEngine) planFile(repoDir string, c *gitChange, copyable bool, p *syncPlan) error {
+	sha, size, err := e.classify(repoDir, c.path)
+	if err != nil {
+		return err
+	}
+
+	// copy the lfs or large file inside obs instead of uploading it again.
+	if copyable && (sha != "" || size >= e.largeFileSize) {
+		p.copies = append(p.copies, CopiedFile{
+			Src: c.src, Dst: c.path, SHA: sha, Size: size,
+		})
+
+		return nil
+	}
+
+	if sha != "" {
+		p.lfs = append(p.lfs, LFSFile{Path: c.path, SHA: sha, Size: size})
+	} else {
+		p.uploads = append(p.uploads, c.path)
+	}
+
+	return nil
+}
+
+// classify returns the sha256 and size of lfs object if the file is
+// a lfs pointer, otherwise returns the size of file.
+func (e *nativeEngine) classify(repoDir, file string) (string, int64, error) {
+	p := filepath.Join(repoDir, file)
+
+	info, err := os.Lstat(p)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if info.Size() >= lfsPointerMaxSize {
+		return "", info.Size(), nil
+	}
+
+	sha, size, err := parseLFSPointer(p)
+	if err != nil || sha == "" {
+		return "", info.Size(), err
+	}
+
+	return sha, size, nil
+}
+
+func (e *nativeEngine) copy(obsPath string, p *syncPlan, r *SyncResult, abort <-chan struct{}) error {
+	failed := make([]bool, len(p.copies))
+
+	err := utils.Parallel(e.workers, len(p.copies), func(i int) error {
+		if err := checkAbort(abort); err != nil {
+			return err
+		}
+
+		c := &p.copies[i]
+		dst := filepath.Join(obsPath, c.Dst)
+		src := filepath.Join(obsPath, c.Src)
+
+		e.log.Debugf("copy file %s to %s", src, dst)
+
+		err := retry(func() error {
+			return e.obsService.CopyObject(dst, src)
+		})
+		if err != nil {
+			// the source may be missing in obs, sync it as a new file.
+			e.log.Warnf(
+				"copy file %s to %s failed, sync it instead, err:%s",
+				src, dst, err.Error(),
+			)
+
+			failed[i] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, c := range p.copies {
+		if !failed[i] {
+			r.CopiedFiles = append(r.CopiedFiles, c)
+
+			continue
+		}
+
+		if c.SHA != "" {
+			p.lfs = append(p.lfs, LFSFile{Path: c.Dst, SHA: c.SHA, Size: c.Size})
+		} else {
+			p.uploads = append(p.uploads, c.Dst)
+		}
+	}
+
+	return nil
+}
+
+func (e *nativeEngine) upload(repoDir, obsPath, file, blob string) (SmallFile, error) {
+	p := filepath.Join(repoDir, file)
+	dst := filepath.Join(obsPath, file)
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return SmallFile{}, err
+	}
+
+	if info.Size() >= e.multipartSize {
+		return SmallFile{Path: file, Size: info.Size()}, e.uploadLarge(p, dst, blob)
+	}
+
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return SmallFile{}, err
+	}
+
+	e.log.Debugf("save file %s to %s", file, dst)
+
+	err = retry(func() error {
+		e.bandwidth.Wait(int64(len(content)))
+
+		return e.obsService.SaveObject(dst, string(content))
+	})
+
+	return SmallFile{
+		Path: file,
+		Size: int64(len(content)),
+		MD5:  utils.GenMD5(content),
+	}, err
+}
+
+// uploadLarge uploads the file by multipart. The checkpoint is kept after
+// failure, so the retry or the later sync of the same blob resumes from it.
+func (e *nativeEngine) uploadLarge(file, dst, blob string) error {
+	v := sha256.Sum256([]byte(dst))
+	checkpoint := obs.Checkpoint{
+		File:    filepath.Join(e.checkpointDir, hex.EncodeToString(v[:])),
+		Version: blob,
+	}
+
+	e.log.Debugf("upload file %s to %s by multipart", file, dst)
+
+	// the parts are charged as they are sent, so the resumed upload
+	// is only charged for the parts left.
+	return retry(func() error {
+		return e.obsService.UploadFile(dst, file, checkpoint, e.bandwidth)
+	})
+}
+
+func (e *nativeEngine) delete(obsPath, file string) error {
+	dst := filepath.Join(obsPath, file)
+
+	e.log.Debugf("delete file %s", dst)
+
+	return retry(func() error {
+		return e.obsService.DeleteObject(dst)
+	})
+}
+
+// parseLFSPointer returns the sha256 and size of lfs object if the file
+// is a lfs pointer, otherwise returns empty string. The pointer must start
+// with the version line and contain both the oid and size.
+func parseLFSPointer(file string) (sha string, size int64, err error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	var (
+		oid     string
+		hasSize bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Text()
+
+		if i == 0 {
+			if !reLFSVersion.MatchString(line) {
+				return
+			}
+
+			continue
+		}
+
+		if m := reLFSOid.FindStringSubmatch(line); len(m) == 2 {
+			oid = m[1]
+		} else if m := reLFSSize.FindStringSubmatch(line); len(m) == 2 {
+			if size, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+				return "", 0, nil
+			}
+
+			hasSize = true
+		}
+	}
+
+	if oid == "" || !hasSize {
+		return "", 0, nil
+	}
+
+	return oid, size, nil
+}
+
+func runGit(dir string, args ...string) ([]byte, error) {
+	return runGitWithEnv(nil, dir, args...)
+}
+
+func runGitWithEnv(env []string, dir string, args ...string) ([]byte, error) {
+	params := append([]string{"git", "-C", dir}, args...)
+
+	out, err, _ := utils.RunCmdWithEnv(env, params...)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"run git %s, err=%s, output=%s",
+			args[0], err.Error(), strings.TrimSpace(string(out)),
+		)
+	}
+
+	return out, nil
+}
+
+func splitNul(v []byte) []string {
+	items := strings.Split(string(v), "\x00")
+
+	r := make([]string, 0, len(items))
+	for _, item := range items {
+		if item != "" {
+			r = append(r, item)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/infrastructure/localimpl"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+}
+
+// TestSyncToLocal syncs a repo to the local storage twice, and the second
+// sync only applies the changes after the first one.
+func TestSyncToLocal(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+
+	git(t, dir, "init", "-q", src)
+	git(t, src, "config", "uploadpack.allowFilter", "true")
+	git(t, src, "config", "uploadpack.allowAnySHA1InWant", "true")
+
+	writeFiles(t, src, map[string]string{
+		"a":         "a",
+		"dir/b":     "b",
+		"dir/sub/c": "c",
+	})
+	git(t, src, "add", "-A")
+	git(t, src, "commit", "-q", "-m", "1")
+
+	s, err := localimpl.NewLocal(&localimpl.Config{Root: filepath.Join(dir, "obs")})
+	if err != nil {
+		t.Fatalf("new local: %v", err)
+	}
+
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	cfg := ServiceConfig{WorkDir: filepath.Join(dir, "work")}
+	cfg.SetDefault()
+
+	e := newNativeEngine(s, &cfg, nil, logrus.NewEntry(log))
+
+	syncRepo := func(start string) SyncResult {
+		workDir, err := ioutil.TempDir(dir, "sync")
+		if err != nil {
+			t.Fatalf("temp dir: %v", err)
+		}
+
+		r, err := e.Sync(&SyncOption{
+			WorkDir:     workDir,
+			CloneURL:    "file://" + src,
+			RepoName:    "repo",
+			OBSPath:     "repos/o/1",
+			StartCommit: start,
+		})
+		if err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+
+		return r
+	}
+
+	objects := func() map[string]string {
+		v, err := s.ListObjects("repos/o/1/")
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+
+		r := map[string]string{}
+		for i := range v {
+			b, err := s.GetObject(v[i].Path)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+
+			r[v[i].Path] = string(b)
+		}
+
+		return r
+	}
+
+	r := syncRepo("")
+
+	want := map[string]string{
+		"repos/o/1/a":         "a",
+		"repos/o/1/dir/b":     "b",
+		"repos/o/1/dir/sub/c": "c",
+	}
+	if v := objects(); !reflect.DeepEqual(v, want) {
+		t.Fatalf("objects of first sync = %v, want %v", v, want)
+	}
+
+	// modify a, delete the dir and add d.
+	writeFiles(t, src, map[string]string{"a": "a2", "d": "d"})
+	git(t, src, "rm", "-q", "-r", "dir")
+	git(t, src, "add", "-A")
+	git(t, src, "commit", "-q", "-m", "2")
+
+	syncRepo(r.LastCommit)
+
+	want = map[string]string{
+		"repos/o/1/a": "a2",
+		"repos/o/1/d": "d",
+	}
+	if v := objects(); !reflect.DeepEqual(v, want) {
+		t.Fatalf("objects of second sync = %v, want %v", v, want)
+	}
+
+	// the empty directories of the deleted files are removed.
+	if _, err := os.Stat(filepath.Join(dir, "obs", "repos/o/1/dir")); !os.IsNotExist(err) {
+		t.Fatalf("the directory of deleted files is left: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLFSPointer(t *testing.T) {
+	const (
+		version = "version https://git-lfs.github.com/spec/v1\n"
+		oid     = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	)
+
+	cases := []struct {
+		name     string
+		content  string
+		wantSHA  string
+		wantSize int64
+	}{
+		{
+			name:     "pointer",
+			content:  version + "oid sha256:" + oid + "\nsize 12345\n",
+			wantSHA:  oid,
+			wantSize: 12345,
+		},
+		{
+			name:     "pointer with extension",
+			content:  version + "ext-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 0\n",
+			wantSHA:  oid,
+			wantSize: 0,
+		},
+		{
+			name:     "legacy version",
+			content:  "version https://hawser.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\n",
+			wantSHA:  oid,
+			wantSize: 1,
+		},
+		{
+			name:    "missing version",
+			content: "oid sha256:" + oid + "\nsize 12345\n",
+		},
+		{
+			name:    "version not at first line",
+			content: "oid sha256:" + oid + "\n" + version + "size 12345\n",
+		},
+		{
+			name:    "missing oid",
+			content: version + "size 12345\n",
+		},
+		{
+			name:    "missing size",
+			content: version + "oid sha256:" + oid + "\n",
+		},
+		{
+			name:    "short oid",
+			content: version + "oid sha256:" + oid[:63] + "\nsize 12345\n",
+		},
+		{
+			name:    "upper case oid",
+			content: version + "oid sha256:" + strings.ToUpper(oid) + "\nsize 12345\n",
+		},
+		{
+			name:    "invalid size",
+			content: version + "oid sha256:" + oid + "\nsize -1\n",
+		},
+		{
+			name:    "overflowed size",
+			content: version + "oid sha256:" + oid + "\nsize 99999999999999999999\n",
+		},
+		{
+			name:    "text file",
+			content: "hello world\n",
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+	}
+
+	dir := t.TempDir()
+
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(dir, strings.Repeat("f", i+1))
+			if err := ioutil.WriteFile(file, []byte(c.content), 0644); err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+
+			sha, size, err := parseLFSPointer(file)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if sha != c.wantSHA || size != c.wantSize {
+				t.Fatalf("got (%s, %d), want (%s, %d)", sha, size, c.wantSHA, c.wantSize)
+			}
+		})
+	}
+
+	if _, _, err := parseLFSPointer(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("parse a missing file, want error")
+	}
+}
@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errQueueStopped = errors.New("sync queue is stopped")
+
+// SyncQueue runs the syncs asynchronously by a fixed number of workers.
+// The pending syncs of same repo are merged into one, and a repo is
+// synced by one worker at a time.
+type SyncQueue interface {
+	// Push adds a sync of repo to queue. done will be called with the
+	// result of sync, and the result of the newer push of same repo if it
+	// is merged into that one. It is called with an error if the sync is
+	// dropped because the queue is stopped.
+	Push(info *RepoInfo, done func(error))
+
+	// Stop waits the running syncs to finish and returns the pending ones
+	// which should be saved to be synced later.
+	Stop() []RepoInfo
+}
+
+type syncJob struct {
+	info RepoInfo
+	done []func(error)
+}
+
+func (job *syncJob) finish(err error) {
+	for _, f := range job.done {
+		f(err)
+	}
+}
+
+func NewSyncQueue(workerNum int, s SyncService, log *logrus.Entry) SyncQueue {
+	q := &syncQueue{
+		service: s,
+		log:     log,
+		pending: map[string]*syncJob{},
+		running: map[string]bool{},
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	q.wg.Add(workerNum)
+	for i := 0; i < workerNum; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+type syncQueue struct {
+	service SyncService
+	log     *logrus.Entry
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// ready is the keys of repos which are pending and not running.
+	ready   []string
+	pending map[string]*syncJob
+	running map[string]bool
+	stopped bool
+}
+
+func (q *syncQueue) Push(info *RepoInfo, done func(error)) {
+	key := info.String()
+	job := &syncJob{info: *info}
+	if done != nil {
+		job.done = []func(error){done}
+	}
+
+	q.mu.Lock()
+
+	if q.stopped {
+		q.mu.Unlock()
+
+		q.log.Warnf("sync queue is stopped, drop the sync of repo(%s)", key)
+
+		job.finish(errQueueStopped)
+
+		return
+	}
+
+	defer q.mu.Unlock()
+
+	if v, ok := q.pending[key]; ok {
+		q.log.Debugf("merge the pending sync of repo(%s)", key)
+
+		job.done = append(v.done, job.done...)
+		q.pending[key] = job
+
+		return
+	}
+
+	q.pending[key] = job
+
+	// it will be ready again when the running one finishes.
+	if !q.running[key] {
+		q.ready = append(q.ready, key)
+		q.cond.Signal()
+	}
+}
+
+func (q *syncQueue) Stop() []RepoInfo {
+	q.mu.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+
+	r := make([]RepoInfo, 0, len(q.pending))
+	for _, job := range q.pending {
+		r = append(r, job.info)
+
+		job.finish(errQueueStopped)
+	}
+
+	return r
+}
+
+func (q *syncQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		key, job := q.next()
+		if job == nil {
+			return
+		}
+
+		err := q.service.SyncRepo(&job.info)
+		if err != nil {
+			q.log.Errorf("sync repo(%s) failed, err:%s", key, err.Error())
+		}
+
+		job.finish(err)
+
+		q.finish(key)
+	}
+}
+
+// next blocks until there is a ready job or the queue is stopped.
+func (q *syncQueue) next() (string, *syncJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.ready) == 0 && !q.stopped {
+		q.cond.Wait()
+	}
+
+	if q.stopped {
+		return "", nil
+	}
+
+	key := q.ready[0]
+	q.ready = q.ready[1:]
+
+	job := q.pending[key]
+	delete(q.pending, key)
+	q.running[key] = true
+
+	return key, job
+}
+
+func (q *syncQueue) finish(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.running, key)
+
+	if _, ok := q.pending[key]; ok {
+		q.ready = append(q.ready, key)
+		q.cond.Signal()
+	}
+}
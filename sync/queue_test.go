@@ -0,0 +1,198 @@
+package sync
+
+import (
+	"errors"
+	"io/ioutil"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+)
+
+// gatedService blocks each sync until it is released, and records the
+// syncs in the order they start.
+type gatedService struct {
+	SyncService
+
+	gate chan struct{}
+
+	lock    gosync.Mutex
+	started []string
+	running map[string]bool
+	overlap bool
+}
+
+func newGatedService() *gatedService {
+	return &gatedService{
+		gate:    make(chan struct{}),
+		running: map[string]bool{},
+	}
+}
+
+func (s *gatedService) SyncRepo(info *RepoInfo) error {
+	key := info.String()
+
+	s.lock.Lock()
+	if s.running[key] {
+		s.overlap = true
+	}
+	s.running[key] = true
+	s.started = append(s.started, info.RepoName)
+	s.lock.Unlock()
+
+	<-s.gate
+
+	s.lock.Lock()
+	delete(s.running, key)
+	s.lock.Unlock()
+
+	if info.RepoName == "fail" {
+		return errors.New("failed")
+	}
+
+	return nil
+}
+
+func (s *gatedService) startedSyncs() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.started...)
+}
+
+// waitStarted waits until n syncs have started.
+func (s *gatedService) waitStarted(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		if len(s.startedSyncs()) >= n {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("started %v, want %d syncs", s.startedSyncs(), n)
+}
+
+func newTestQueue(workers int, s SyncService) SyncQueue {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	return NewSyncQueue(workers, s, logrus.NewEntry(log))
+}
+
+// results collects the results of done.
+type results struct {
+	lock gosync.Mutex
+	v    map[string]error
+}
+
+func (r *results) done(name string) func(error) {
+	return func(err error) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		r.v[name] = err
+	}
+}
+
+func (r *results) get() map[string]error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	v := map[string]error{}
+	for k, err := range r.v {
+		v[k] = err
+	}
+
+	return v
+}
+
+func testRepo(repoId, name string) *RepoInfo {
+	owner, _ := domain.NewAccount("owner")
+
+	return &RepoInfo{Owner: owner, RepoId: repoId, RepoName: name}
+}
+
+func TestQueueMergeAndOrder(t *testing.T) {
+	s := newGatedService()
+	q := newTestQueue(2, s)
+	r := &results{v: map[string]error{}}
+
+	q.Push(testRepo("1", "first"), r.done("first"))
+	s.waitStarted(t, 1)
+
+	// the pushes are merged while the first one is running.
+	q.Push(testRepo("1", "second"), r.done("second"))
+	q.Push(testRepo("1", "fail"), r.done("third"))
+
+	// the sync of first one is released, then the merged one.
+	s.gate <- struct{}{}
+	s.waitStarted(t, 2)
+	s.gate <- struct{}{}
+
+	q.Stop()
+
+	if v := s.startedSyncs(); len(v) != 2 || v[0] != "first" || v[1] != "fail" {
+		t.Fatalf("started %v, want the first and the last one", v)
+	}
+
+	if s.overlap {
+		t.Fatal("the same repo is synced at the same time")
+	}
+
+	v := r.get()
+	if len(v) != 3 || v["first"] != nil || v["second"] == nil || v["third"] == nil {
+		t.Fatalf("results = %v, the merged ones get the result of the last one", v)
+	}
+}
+
+func TestQueueStop(t *testing.T) {
+	s := newGatedService()
+	q := newTestQueue(1, s)
+	r := &results{v: map[string]error{}}
+
+	q.Push(testRepo("1", "running"), r.done("running"))
+	s.waitStarted(t, 1)
+
+	q.Push(testRepo("2", "pending"), r.done("pending"))
+	q.Push(testRepo("2", "merged"), r.done("merged"))
+
+	stopped := make(chan []RepoInfo)
+	go func() {
+		stopped <- q.Stop()
+	}()
+
+	// the running sync is waited.
+	select {
+	case <-stopped:
+		t.Fatal("stop doesn't wait the running sync")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.gate <- struct{}{}
+
+	pending := <-stopped
+	if len(pending) != 1 || pending[0].RepoName != "merged" {
+		t.Fatalf("pending = %+v, want the merged one", pending)
+	}
+
+	q.Push(testRepo("3", "late"), r.done("late"))
+
+	v := r.get()
+	if v["running"] != nil {
+		t.Fatalf("the running sync failed: %v", v["running"])
+	}
+
+	for _, k := range []string{"pending", "merged", "late"} {
+		if err, ok := v[k]; !ok || err != errQueueStopped {
+			t.Errorf("result of %s = %v, want %v", k, err, errQueueStopped)
+		}
+	}
+
+	if n := len(s.startedSyncs()); n != 1 {
+		t.Fatalf("started %d syncs after stop, want 1", n)
+	}
+}
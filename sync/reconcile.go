@@ -0,0 +1,285 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+// ReconcileResult is the difference between the mirror and the last commit.
+type ReconcileResult struct {
+	LastCommit string
+	Missing    []string
+	Changed    []string
+	Orphaned   []string
+}
+
+// expectedFile is a file of repo. sha is set if it is a lfs pointer, and
+// blob is the sha of its git blob.
+type expectedFile struct {
+	sha  string
+	size int64
+	blob string
+}
+
+// Reconcile makes the mirror of repo same as its last commit by comparing
+// the whole tree with the objects in obs. Nothing is changed if dryRun is true.
+func (s *syncService) Reconcile(info *RepoInfo, dryRun bool) (r ReconcileResult, err error) {
+	if dryRun {
+		c, err := s.lock.Find(info.Owner, info.RepoId, info.Ref)
+		if err != nil && !synclock.IsRepoSyncLockNotExist(err) {
+			return r, err
+		}
+
+		if err := s.resolveType(info, &c); err != nil {
+			return r, err
+		}
+
+		return s.reconcile(info, true, nil)
+	}
+
+	c, takeover, err := s.findLock(info)
+	if err != nil {
+		return
+	}
+
+	if err = s.resolveType(info, &c); err != nil {
+		return
+	}
+
+	if c, err = s.acquireLock(&c, info, takeover); err != nil {
+		return
+	}
+
+	stop, lost := s.keepLease(&c, info)
+	r, err = s.reconcile(info, false, lost)
+	stop()
+
+	if checkAbort(lost) == nil {
+		s.releaseLock(&c, info, r.LastCommit, err)
+	} else {
+		err = errLeaseLost
+	}
+
+	return
+}
+
+func (s *syncService) reconcile(info *RepoInfo, dryRun bool, abort <-chan struct{}) (
+	r ReconcileResult, err error,
+) {
+	tempDir, err := ioutil.TempDir(s.cfg.WorkDir, "reconcile")
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	env := s.gitEnv()
+
+	repoDir, last, done, err := s.native.clone(&SyncOption{
+		WorkDir:  tempDir,
+		CloneURL: s.ph.GetCloneURL(info.Owner.Account(), info.RepoName),
+		Env:      env,
+		RepoName: info.RepoName,
+		Branch:   info.shortRef(),
+	})
+	if err != nil {
+		return
+	}
+	defer done()
+
+	r.LastCommit = last
+
+	expected, err := s.listExpectedFiles(repoDir, env, last)
+	if err != nil {
+		return
+	}
+
+	obsPath := s.h.refOBSPath(info)
+	objs, err := s.listMirrorObjects(obsPath)
+	if err != nil {
+		return
+	}
+
+	for _, f := range sortedKeys(expected) {
+		meta, ok := objs[f]
+		if !ok {
+			r.Missing = append(r.Missing, f)
+
+			continue
+		}
+
+		changed, err := s.isChanged(repoDir, f, expected[f], meta)
+		if err != nil {
+			return r, err
+		}
+
+		if changed {
+			r.Changed = append(r.Changed, f)
+		}
+	}
+
+	for p := range objs {
+		if _, ok := expected[p]; !ok {
+			r.Orphaned = append(r.Orphaned, p)
+		}
+	}
+	sort.Strings(r.Orphaned)
+
+	if dryRun {
+		return
+	}
+
+	err = s.repair(repoDir, obsPath, expected, &r, abort)
+
+	return
+}
+
+func (s *syncService) listExpectedFiles(repoDir string, env []string, last string) (
+	map[string]expectedFile, error,
+) {
+	changes, err := s.native.listChanges(repoDir, env, "", last)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.native.checkout(repoDir, env, last, changedPaths(changes)); err != nil {
+		return nil, err
+	}
+
+	r := make(map[string]expectedFile, len(changes))
+
+	for i := range changes {
+		c := &changes[i]
+
+		if !isRegular(c.newMode) {
+			continue
+		}
+
+		sha, size, err := s.native.classify(repoDir, c.path)
+		if err != nil {
+			return nil, err
+		}
+
+		r[c.path] = expectedFile{sha: sha, size: size, blob: c.newSHA}
+	}
+
+	return r, nil
+}
+
+// listMirrorObjects returns the objects of mirror whose keys are the paths
+// relative to the mirror. The commit file is excluded.
+func (s *syncService) listMirrorObjects(obsPath string) (
+	map[string]obs.ObjectMeta, error,
+) {
+	prefix := s.h.getRepoObsPath(obsPath) + "/"
+
+	objs, err := s.obsService.ListObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	commitFile := s.h.commitFilePath(obsPath)
+
+	r := make(map[string]obs.ObjectMeta, len(objs))
+
+	for i := range objs {
+		p := objs[i].Path
+
+		if p == commitFile {
+			continue
+		}
+
+		r[strings.TrimPrefix(p, prefix)] = objs[i]
+	}
+
+	return r, nil
+}
+
+func (s *syncService) isChanged(repoDir, f string, e expectedFile, meta obs.ObjectMeta) (bool, error) {
+	if meta.Size != e.size {
+		return true, nil
+	}
+
+	if e.sha != "" {
+		src, err := s.obsService.GetObjectMeta(s.h.lfsOBSPath(e.sha))
+		if err != nil {
+			return false, err
+		}
+
+		return src != nil && isETagChanged(src.ETag, meta.ETag), nil
+	}
+
+	if isMultipartETag(meta.ETag) {
+		return false, nil
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(repoDir, f))
+	if err != nil {
+		return false, err
+	}
+
+	return utils.GenMD5(content) != meta.ETag, nil
+}
+
+func (s *syncService) repair(
+	repoDir, obsPath string, expected map[string]expectedFile, r *ReconcileResult,
+	abort <-chan struct{},
+) error {
+	fullPath := s.h.getRepoObsPath(obsPath)
+
+	files := append(append([]string{}, r.Missing...), r.Changed...)
+
+	for _, f := range files {
+		if err := checkAbort(abort); err != nil {
+			return err
+		}
+
+		e := expected[f]
+
+		if e.sha != "" {
+			if err := s.h.syncLFSFile(e.sha, filepath.Join(obsPath, f)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, err := s.native.upload(repoDir, fullPath, f, e.blob); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range r.Orphaned {
+		if err := checkAbort(abort); err != nil {
+			return err
+		}
+
+		if err := s.native.delete(fullPath, f); err != nil {
+			return err
+		}
+	}
+
+	if err := checkAbort(abort); err != nil {
+		return err
+	}
+
+	return s.h.saveLastCommit(obsPath, r.LastCommit)
+}
+
+func sortedKeys(m map[string]expectedFile) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+
+	sort.Strings(r)
+
+	return r
+}
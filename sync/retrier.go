@@ -0,0 +1,362 @@
+package sync
+
+import (
+	gosync "sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synctask"
+)
+
+const maxLastErrorLen = 1024
+
+// SyncRetrier is a SyncService which records the failed syncs as tasks
+// and retries them with exponential backoff until they succeed or die.
+type SyncRetrier interface {
+	SyncService
+
+	// Run pushes the due tasks to queue periodically until Stop is called.
+	Run(SyncQueue)
+	Stop()
+
+	// Defer saves the sync which has not run as a due task, so that it
+	// will be pushed to queue by the next run of any instance.
+	Defer(*RepoInfo) error
+
+	// ApplyChange saves the change of repo, such as deleting it, as a task
+	// and applies it in background. The failed change is retried like the
+	// failed sync. The Owner of info is the new owner for MoveRepo.
+	ApplyChange(action string, info *RepoInfo) error
+}
+
+func NewSyncRetrier(
+	cfg *RetryConfig, s SyncService, l LifecycleService,
+	t synctask.SyncTask, log *logrus.Entry,
+) SyncRetrier {
+	return &syncRetrier{
+		cfg:       *cfg,
+		service:   s,
+		lifecycle: l,
+		task:      t,
+		log:       log,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+type syncRetrier struct {
+	cfg       RetryConfig
+	service   SyncService
+	lifecycle LifecycleService
+	task      synctask.SyncTask
+	log       *logrus.Entry
+
+	// wg waits the changes which are applied in background.
+	wg gosync.WaitGroup
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (r *syncRetrier) SyncRepo(info *RepoInfo) error {
+	err := r.service.SyncRepo(info)
+
+	t, err1 := r.task.Find(info.Owner, info.RepoId, info.Ref)
+	if err1 != nil {
+		if !synctask.IsSyncTaskNotExist(err1) {
+			r.log.Errorf(
+				"find sync task of repo(%s) failed, err:%s",
+				info.String(), err1.Error(),
+			)
+
+			return err
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		t.Owner = info.Owner
+		t.RepoId = info.RepoId
+		t.Ref = info.Ref
+	} else if t.Action != domain.SyncTaskActionSync {
+		// the pending change of repo is not replaced by the sync.
+		return err
+	}
+
+	if err == nil {
+		if err1 := r.task.Remove(&t); err1 != nil {
+			r.log.Errorf(
+				"remove sync task of repo(%s) failed, err:%s",
+				info.String(), err1.Error(),
+			)
+		}
+
+		return nil
+	}
+
+	if IsRepoBusy(err) {
+		r.busy(&t, info, err)
+	} else {
+		r.failed(&t, info, err)
+	}
+
+	return err
+}
+
+func (r *syncRetrier) Defer(info *RepoInfo) error {
+	t, err := r.task.Find(info.Owner, info.RepoId, info.Ref)
+	if err != nil {
+		if !synctask.IsSyncTaskNotExist(err) {
+			return err
+		}
+
+		t.Owner = info.Owner
+		t.RepoId = info.RepoId
+		t.Ref = info.Ref
+	} else if t.Action != domain.SyncTaskActionSync {
+		return nil
+	}
+
+	t.RepoName = info.RepoName
+	t.Status = domain.SyncTaskStatusPending
+	t.NextRetry = time.Now().Unix()
+
+	_, err = r.task.Save(&t)
+
+	return err
+}
+
+// ApplyChange replaces the pending sync of the same ref, because the sync
+// is useless if the ref or repo is deleted. The task of deleting repo
+// replaces the sync of default branch, and the syncs of the other refs are
+// removed after the repo is deleted.
+func (r *syncRetrier) ApplyChange(action string, info *RepoInfo) error {
+	t, err := r.task.Find(info.Owner, info.RepoId, info.Ref)
+	if err != nil {
+		if !synctask.IsSyncTaskNotExist(err) {
+			return err
+		}
+
+		t.Owner = info.Owner
+		t.RepoId = info.RepoId
+		t.Ref = info.Ref
+	}
+
+	t.RepoName = info.RepoName
+	t.Action = action
+	t.Status = domain.SyncTaskStatusPending
+	t.Attempts = 0
+	t.LastError = ""
+
+	return r.applyChange(&t)
+}
+
+// applyChange delays the task before applying it, so that it is retried
+// only if this instance exits before it is done. The change is idempotent,
+// so it is fine if the other instance retries it at the same time.
+func (r *syncRetrier) applyChange(t *domain.SyncTask) error {
+	t.NextRetry = time.Now().Add(r.backoff(t.Attempts + 1)).Unix()
+
+	v, err := r.task.Save(t)
+	if err != nil {
+		return err
+	}
+
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		r.change(&v)
+	}()
+
+	return nil
+}
+
+func (r *syncRetrier) change(t *domain.SyncTask) {
+	info := RepoInfo{
+		Owner:    t.Owner,
+		RepoId:   t.RepoId,
+		RepoName: t.RepoName,
+		Ref:      t.Ref,
+	}
+
+	var err error
+
+	switch t.Action {
+	case domain.SyncTaskActionDeleteRef:
+		err = r.lifecycle.DeleteRef(&info)
+
+	case domain.SyncTaskActionDeleteRepo:
+		err = r.lifecycle.DeleteRepo(t.RepoId)
+
+	case domain.SyncTaskActionMoveRepo:
+		err = r.lifecycle.MoveRepo(t.RepoId, t.Owner)
+	}
+
+	if err != nil {
+		r.log.Errorf(
+			"%s of repo(%s) failed, err:%s", t.Action, info.String(), err.Error(),
+		)
+
+		r.failed(t, &info, err)
+
+		return
+	}
+
+	if t.Action == domain.SyncTaskActionDeleteRepo {
+		// the pending syncs of the deleted repo are cancelled.
+		err = r.task.RemoveByRepo(t.RepoId)
+	} else {
+		err = r.task.Remove(t)
+	}
+
+	if err != nil {
+		r.log.Errorf(
+			"remove sync task of repo(%s) failed, err:%s",
+			info.String(), err.Error(),
+		)
+	}
+}
+
+// Reconcile is not retried since it is triggered manually.
+func (r *syncRetrier) Reconcile(info *RepoInfo, dryRun bool) (ReconcileResult, error) {
+	return r.service.Reconcile(info, dryRun)
+}
+
+func (r *syncRetrier) failed(t *domain.SyncTask, info *RepoInfo, err error) {
+	t.RepoName = info.RepoName
+	t.Attempts++
+	t.LastError = truncateError(err)
+
+	t.Status = domain.SyncTaskStatusPending
+	if t.Attempts >= r.cfg.MaxAttempts {
+		t.Status = domain.SyncTaskStatusDead
+
+		r.log.Errorf(
+			"sync repo(%s) failed %d times, it will not be retried any more",
+			info.String(), t.Attempts,
+		)
+	}
+
+	t.NextRetry = time.Now().Add(r.backoff(t.Attempts)).Unix()
+
+	if _, err1 := r.task.Save(t); err1 != nil {
+		r.log.Errorf(
+			"save sync task of repo(%s) failed, err:%s",
+			info.String(), err1.Error(),
+		)
+	}
+}
+
+// busy reschedules the sync of repo which is being synced by others
+// without counting it as a failed attempt. It is still needed because the
+// running sync may not include the latest commit.
+func (r *syncRetrier) busy(t *domain.SyncTask, info *RepoInfo, err error) {
+	t.RepoName = info.RepoName
+	t.LastError = truncateError(err)
+	t.Status = domain.SyncTaskStatusPending
+	t.NextRetry = time.Now().Add(r.backoff(1)).Unix()
+
+	if _, err1 := r.task.Save(t); err1 != nil {
+		r.log.Errorf(
+			"save sync task of repo(%s) failed, err:%s",
+			info.String(), err1.Error(),
+		)
+	}
+}
+
+// backoff doubles the interval after each attempt.
+func (r *syncRetrier) backoff(attempts int) time.Duration {
+	d := time.Duration(r.cfg.BackoffBase) * time.Second
+	max := time.Duration(r.cfg.BackoffMax) * time.Second
+
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+func (r *syncRetrier) Run(q SyncQueue) {
+	go func() {
+		defer close(r.done)
+
+		t := time.NewTicker(time.Duration(r.cfg.RetryInterval) * time.Second)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+
+			case <-t.C:
+				r.retry(q)
+			}
+		}
+	}()
+}
+
+func (r *syncRetrier) Stop() {
+	close(r.stop)
+	<-r.done
+
+	r.wg.Wait()
+}
+
+func (r *syncRetrier) retry(q SyncQueue) {
+	tasks, err := r.task.FindDue(time.Now().Unix(), r.cfg.RetryBatch)
+	if err != nil {
+		r.log.Errorf("find due sync tasks failed, err:%s", err.Error())
+
+		return
+	}
+
+	for i := range tasks {
+		t := &tasks[i]
+
+		if t.Action != domain.SyncTaskActionSync {
+			r.log.Infof(
+				"retry %s of repo(%s), attempts=%d", t.Action, t.RepoId, t.Attempts,
+			)
+
+			if err := r.applyChange(t); err != nil {
+				r.log.Errorf(
+					"retry %s of repo(%s) failed, err:%s",
+					t.Action, t.RepoId, err.Error(),
+				)
+			}
+
+			continue
+		}
+
+		info := RepoInfo{
+			Owner:    t.Owner,
+			RepoId:   t.RepoId,
+			RepoName: t.RepoName,
+			Ref:      t.Ref,
+		}
+
+		r.log.Infof(
+			"retry sync repo(%s), attempts=%d", info.String(), t.Attempts,
+		)
+
+		q.Push(&info, nil)
+	}
+}
+
+func truncateError(err error) string {
+	v := err.Error()
+	if len(v) > maxLastErrorLen {
+		v = v[:maxLastErrorLen]
+	}
+
+	return v
+}
@@ -0,0 +1,257 @@
+package sync
+
+import (
+	"errors"
+	"io/ioutil"
+	gosync "sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synctask"
+)
+
+// memTask keeps the tasks in memory, and FindDue returns all the pending
+// tasks no matter when they are due.
+type memTask struct {
+	lock  gosync.Mutex
+	tasks map[string]domain.SyncTask
+}
+
+func (m *memTask) key(owner domain.Account, repoId, ref string) string {
+	return owner.Account() + "/" + repoId + "/" + ref
+}
+
+func (m *memTask) Find(owner domain.Account, repoId, ref string) (domain.SyncTask, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if v, ok := m.tasks[m.key(owner, repoId, ref)]; ok {
+		return v, nil
+	}
+
+	return domain.SyncTask{}, synctask.NewErrorTaskNotExists(errors.New("not exist"))
+}
+
+func (m *memTask) FindDue(now int64, limit int) (r []domain.SyncTask, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, v := range m.tasks {
+		if !v.Status.IsDead() {
+			r = append(r, v)
+		}
+	}
+
+	return
+}
+
+func (m *memTask) Save(t *domain.SyncTask) (domain.SyncTask, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	v := *t
+	if v.Id == "" {
+		v.Id = m.key(t.Owner, t.RepoId, t.Ref)
+	} else {
+		v.Version++
+	}
+
+	m.tasks[m.key(t.Owner, t.RepoId, t.Ref)] = v
+
+	return v, nil
+}
+
+func (m *memTask) Remove(t *domain.SyncTask) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.tasks, m.key(t.Owner, t.RepoId, t.Ref))
+
+	return nil
+}
+
+func (m *memTask) RemoveByRepo(repoId string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for k, v := range m.tasks {
+		if v.RepoId == repoId {
+			delete(m.tasks, k)
+		}
+	}
+
+	return nil
+}
+
+// failedLifecycle fails the first failures changes.
+type failedLifecycle struct {
+	LifecycleService
+
+	failures int
+	deleted  []string
+}
+
+func (l *failedLifecycle) DeleteRepo(repoId string) error {
+	if l.failures > 0 {
+		l.failures--
+
+		return errors.New("obs is unavailable")
+	}
+
+	l.deleted = append(l.deleted, repoId)
+
+	return nil
+}
+
+// failedService fails all the syncs.
+type failedService struct {
+	SyncService
+}
+
+func (failedService) SyncRepo(*RepoInfo) error {
+	return errors.New("can't sync")
+}
+
+// pushedQueue records the pushed syncs.
+type pushedQueue struct {
+	SyncQueue
+
+	pushed []RepoInfo
+}
+
+func (q *pushedQueue) Push(info *RepoInfo, done func(error)) {
+	q.pushed = append(q.pushed, *info)
+}
+
+func newTestRetrier(l LifecycleService) (*syncRetrier, *memTask) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	cfg := RetryConfig{}
+	cfg.SetDefault()
+
+	t := &memTask{tasks: map[string]domain.SyncTask{}}
+
+	r := NewSyncRetrier(&cfg, failedService{}, l, t, logrus.NewEntry(log))
+
+	return r.(*syncRetrier), t
+}
+
+func TestRetryDeleteRepo(t *testing.T) {
+	l := &failedLifecycle{failures: 1}
+	r, tasks := newTestRetrier(l)
+
+	owner, _ := domain.NewAccount("owner")
+	repo := RepoInfo{Owner: owner, RepoId: "1"}
+	ref := RepoInfo{Owner: owner, RepoId: "1", Ref: "refs/heads/dev"}
+
+	// the pending sync of the other ref.
+	if err := r.Defer(&ref); err != nil {
+		t.Fatalf("defer: %v", err)
+	}
+
+	if err := r.ApplyChange(domain.SyncTaskActionDeleteRepo, &repo); err != nil {
+		t.Fatalf("apply change: %v", err)
+	}
+	r.wg.Wait()
+
+	v, err := tasks.Find(owner, "1", "")
+	if err != nil || v.Action != domain.SyncTaskActionDeleteRepo || v.Attempts != 1 {
+		t.Fatalf("the failed change is not saved: %+v, %v", v, err)
+	}
+
+	// the failed sync of default branch doesn't replace the change.
+	if err := r.SyncRepo(&repo); err == nil {
+		t.Fatal("want error of sync")
+	}
+
+	if v, _ := tasks.Find(owner, "1", ""); v.Action != domain.SyncTaskActionDeleteRepo {
+		t.Fatalf("the change is replaced: %+v", v)
+	}
+
+	q := &pushedQueue{}
+	r.retry(q)
+	r.wg.Wait()
+
+	if len(q.pushed) != 1 || q.pushed[0].Ref != ref.Ref {
+		t.Fatalf("pushed %+v, want the sync of %s", q.pushed, ref.Ref)
+	}
+
+	if len(l.deleted) != 1 {
+		t.Fatalf("the repo is deleted %d times, want 1", len(l.deleted))
+	}
+
+	if len(tasks.tasks) != 0 {
+		t.Fatalf("the tasks of deleted repo are not removed: %+v", tasks.tasks)
+	}
+}
+
+func TestRetryDeadChange(t *testing.T) {
+	r, tasks := newTestRetrier(&failedLifecycle{failures: 100})
+	r.cfg.MaxAttempts = 2
+
+	owner, _ := domain.NewAccount("owner")
+
+	if err := r.ApplyChange(
+		domain.SyncTaskActionDeleteRepo, &RepoInfo{Owner: owner, RepoId: "1"},
+	); err != nil {
+		t.Fatalf("apply change: %v", err)
+	}
+	r.wg.Wait()
+
+	for i := 0; i < 3; i++ {
+		r.retry(&pushedQueue{})
+		r.wg.Wait()
+	}
+
+	v, _ := tasks.Find(owner, "1", "")
+	if !v.Status.IsDead() || v.Attempts != 2 {
+		t.Fatalf("the change is not dead: %+v", v)
+	}
+}
+
+// busyService fails all the syncs because the repos are being synced by
+// the other instance.
+type busyService struct {
+	SyncService
+}
+
+func (busyService) SyncRepo(*RepoInfo) error {
+	return errorRepoBusy{errors.New("repo is being synced by other")}
+}
+
+func TestRetryBusySync(t *testing.T) {
+	r, tasks := newTestRetrier(nil)
+	r.service = busyService{}
+
+	owner, _ := domain.NewAccount("owner")
+	info := RepoInfo{Owner: owner, RepoId: "1"}
+
+	for i := 0; i < 3; i++ {
+		if err := r.SyncRepo(&info); !IsRepoBusy(err) {
+			t.Fatalf("want busy error, got %v", err)
+		}
+	}
+
+	v, err := tasks.Find(owner, "1", "")
+	if err != nil || v.Attempts != 0 || v.Status.IsDead() {
+		t.Fatalf("the busy sync is counted as failure: %+v, %v", v, err)
+	}
+
+	// the earlier failures are kept.
+	r.service = failedService{}
+	if err := r.SyncRepo(&info); err == nil {
+		t.Fatal("want error of sync")
+	}
+
+	r.service = busyService{}
+	if err := r.SyncRepo(&info); err == nil {
+		t.Fatal("want error of sync")
+	}
+
+	if v, _ := tasks.Find(owner, "1", ""); v.Attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", v.Attempts)
+	}
+}
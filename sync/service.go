@@ -7,11 +7,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain/platform"
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synchistory"
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain/synclock"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
 	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -20,14 +23,42 @@ type RepoInfo struct {
 	Owner    domain.Account
 	RepoId   string
 	RepoName string
+
+	// Ref is the full name of branch or tag, like refs/heads/dev or
+	// refs/tags/v1.0. It is empty for the default branch.
+	Ref string
+
+	// Type is the resource type of repo which is resolved before sync.
+	Type domain.ResourceType
+}
+
+func (s *RepoInfo) platformRepo() *platform.Repo {
+	return &platform.Repo{
+		Id:    s.RepoId,
+		Owner: s.Owner.Account(),
+		Name:  s.RepoName,
+	}
+}
+
+// shortRef returns the name of branch or tag.
+func (s *RepoInfo) shortRef() string {
+	return strings.TrimPrefix(
+		strings.TrimPrefix(s.Ref, refBranchPrefix), refTagPrefix,
+	)
 }
 
-func (s *RepoInfo) repoOBSPath() string {
-	return filepath.Join(s.Owner.Account(), s.RepoId)
+func (s *RepoInfo) String() string {
+	v := filepath.Join(s.Owner.Account(), s.RepoId)
+	if s.Ref == "" {
+		return v
+	}
+
+	return v + "@" + s.Ref
 }
 
 type SyncService interface {
 	SyncRepo(*RepoInfo) error
+	Reconcile(info *RepoInfo, dryRun bool) (ReconcileResult, error)
 }
 
 func NewSyncService(
@@ -35,120 +66,238 @@ func NewSyncService(
 	s obs.OBS,
 	p platform.Platform,
 	l synclock.RepoSyncLock,
+	sh synchistory.SyncHistory,
 ) (SyncService, error) {
-	if err := os.Mkdir(cfg.WorkDir, 0755); err != nil {
+	if err := os.MkdirAll(cfg.WorkDir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg.WorkDir, checkpointDir), 0755); err != nil {
 		return nil, err
 	}
 
+	askPass, err := writeAskPass(cfg.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var mirrors *mirrorCache
+	if cfg.MirrorCacheSize > 0 {
+		mirrors, err = newMirrorCache(
+			filepath.Join(cfg.WorkDir, mirrorCacheDir), cfg.MirrorCacheSize, log,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	native := newNativeEngine(s, &cfg.ServiceConfig, mirrors, log)
+
+	var engine SyncEngine = native
+	if cfg.IsShellEngine() {
+		engine = newShellEngine(
+			cfg.SyncFileShell, cfg.OBSUtilPath, cfg.OBSBucket, log,
+		)
+	}
+
+	h := &syncHelper{
+		obsService: s,
+		cfg:        cfg.HelperConfig,
+	}
+
 	return &syncService{
-		h: &syncHelper{
-			obsService: s,
-			cfg:        cfg.HelperConfig,
-		},
-		log:       log,
-		cfg:       cfg.ServiceConfig,
-		lock:      l,
-		ph:        p,
-		obsutil:   s.OBSUtilPath(),
-		obsBucket: s.OBSBucket(),
+		h:          h,
+		v:          &verifier{h: h, obsService: s},
+		log:        log,
+		cfg:        cfg.ServiceConfig,
+		lock:       l,
+		history:    sh,
+		ph:         p,
+		engine:     engine,
+		native:     native,
+		obsService: s,
+		askPass:    askPass,
+		lease:      time.Duration(cfg.LeaseDuration) * time.Second,
 	}, nil
 }
 
 type syncService struct {
 	h   *syncHelper
+	v   *verifier
 	log *logrus.Entry
 	cfg ServiceConfig
 
-	obsutil   string
-	obsBucket string
+	engine SyncEngine
+	// native is used by reconciliation whichever the engine is.
+	native     *nativeEngine
+	obsService obs.OBS
+
+	// askPass is the script of GIT_ASKPASS.
+	askPass string
+
+	lock    synclock.RepoSyncLock
+	ph      platform.Platform
+	history synchistory.SyncHistory
+
+	lease time.Duration
+}
 
-	lock synclock.RepoSyncLock
-	ph   platform.Platform
+func (s *syncService) gitEnv() []string {
+	return append(
+		gitCredentialEnv(s.askPass, s.ph.GetCredential()), envLFSSkipSmudge,
+	)
 }
 
 func (s *syncService) SyncRepo(info *RepoInfo) error {
-	c, err := s.lock.Find(info.Owner, info.RepoId)
+	start := time.Now()
+
+	c, takeover, err := s.findLock(info)
+	if err == errRepoBlocked {
+		// it is not retried until unblocked.
+		s.skipSync(info, start, &c)
+
+		return nil
+	}
+
 	if err != nil {
-		if !synclock.IsRepoSyncLockNotExist(err) {
-			return err
-		}
+		return s.failBeforeSync(info, start, &c, metrics.StageLock, err)
+	}
 
-		c.Owner = info.Owner
-		c.RepoId = info.RepoId
+	if err := s.resolveType(info, &c); err != nil {
+		return s.failBeforeSync(info, start, &c, metrics.StagePlatform, err)
 	}
 
-	if c.Status != nil && !c.Status.IsDone() {
-		// TODO: mybe dead lock, try to unlock it and continue
+	if p := s.cfg.policy(c.RepoType); p.Disabled || !p.isRefAllowed(info.Ref) {
+		s.log.Debugf("skip the sync of repo(%s) which is not allowed", info.String())
 
-		return errors.New("can't sync")
+		return nil
 	}
 
-	lastCommit, err := s.ph.GetLastCommit(info.RepoId)
+	lastCommit, err := s.ph.GetLastCommit(info.platformRepo(), info.Ref)
 	if err != nil {
-		return err
+		return s.failBeforeSync(info, start, &c, metrics.StagePlatform, err)
 	}
 
-	if c.LastCommit == lastCommit {
+	if c.LastCommit == lastCommit && !takeover {
 		return nil
 	}
 
-	// try lock
-	c.Status = domain.RepoSyncStatusRunning
-	c, err = s.lock.Save(&c)
+	v, err := s.acquireLock(&c, info, takeover)
 	if err != nil {
-		return err
+		return s.failBeforeSync(info, start, &c, metrics.StageLock, err)
 	}
 
+	c = v
+
+	metrics.SyncsStarted.Inc()
+	metrics.RunningSyncs.Inc()
+	start = time.Now()
+
 	// do sync
-	lastCommit, syncErr := s.doSync(c.LastCommit, info)
-	if syncErr == nil {
-		c.LastCommit = lastCommit
+	startCommit := c.LastCommit
+	stop, lost := s.keepLease(&c, info)
+	r, syncErr := s.doSync(startCommit, info, lost)
+	stop()
+
+	if checkAbort(lost) == nil {
+		s.releaseLock(&c, info, r.LastCommit, syncErr)
+	} else {
+		syncErr = failAt(metrics.StageLock, errLeaseLost)
 	}
-	c.Status = domain.RepoSyncStatusDone
 
-	// unlock
-	err = utils.Retry(func() error {
-		_, err := s.lock.Save(&c)
+	metrics.RunningSyncs.Dec()
+	observeSync(start, syncErr)
+
+	s.saveHistory(info, start, startCommit, &r, syncErr)
+
+	return syncErr
+}
+
+// resolveType sets the type of repo. The type saved in the lock is used
+// once it is known, so that the mirror doesn't move when the repo is marked
+// with the other type on the platform.
+func (s *syncService) resolveType(info *RepoInfo, c *domain.RepoSyncLock) error {
+	if c.RepoType == nil {
+		t, err := s.ph.GetRepoType(info.platformRepo())
 		if err != nil {
-			s.log.Errorf(
-				"save sync repo(%s) failed, err:%s, value=%v",
-				info.repoOBSPath(), err.Error(), c,
-			)
+			return err
 		}
 
-		return err
-	})
-	if err != nil {
-		s.log.Errorf(
-			"save sync repo(%s) failed, dead lock happened",
-			info.repoOBSPath(),
-		)
+		if t == nil {
+			t = s.h.cfg.defaultRepoType()
+		}
+
+		c.RepoType = t
 	}
 
-	return syncErr
+	info.Type = c.RepoType
+
+	return nil
 }
 
-func (s *syncService) doSync(startCommit string, info *RepoInfo) (lastCommit string, err error) {
-	if lastCommit, err = s.sync(startCommit, info); err != nil {
+// stageError is the error of sync with the stage where it fails.
+type stageError struct {
+	error
+
+	stage string
+}
+
+func failAt(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return stageError{error: err, stage: stage}
+}
+
+func observeSync(start time.Time, err error) {
+	result := "succeeded"
+
+	if err == nil {
+		metrics.SyncsSucceeded.Inc()
+	} else {
+		result = "failed"
+
+		stage := metrics.StageEngine
+		if v, ok := err.(stageError); ok {
+			stage = v.stage
+		}
+
+		metrics.SyncsFailed.WithLabelValues(stage).Inc()
+	}
+
+	metrics.SyncDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+func (s *syncService) doSync(startCommit string, info *RepoInfo, abort <-chan struct{}) (
+	r SyncResult, err error,
+) {
+	if r, err = s.sync(startCommit, info, abort); err != nil {
 		return
 	}
 
-	err = s.h.saveLastCommit(info.repoOBSPath(), lastCommit)
+	if err = checkAbort(abort); err != nil {
+		return
+	}
+
+	err = s.h.saveLastCommit(s.h.refOBSPath(info), r.LastCommit)
 	if err != nil {
 		s.log.Errorf(
 			"update last commit failed, err:%s",
 			err.Error(),
 		)
 
-		err = errors.New(
+		err = failAt(metrics.StageCommitSave, errors.New(
 			"sync successfully , but save last commit to obs failed",
-		)
+		))
 	}
 
 	return
 }
 
-func (s *syncService) sync(startCommit string, info *RepoInfo) (last string, err error) {
+func (s *syncService) sync(startCommit string, info *RepoInfo, abort <-chan struct{}) (
+	r SyncResult, err error,
+) {
 	tempDir, err := ioutil.TempDir(s.cfg.WorkDir, "sync")
 	if err != nil {
 		return
@@ -156,66 +305,95 @@ func (s *syncService) sync(startCommit string, info *RepoInfo) (last string, err
 
 	defer os.RemoveAll(tempDir)
 
-	last, lfsFile, err := s.syncFile(tempDir, startCommit, info)
-	s.log.Debugf(
-		"sync file for repo:%s, last commit=%s, lfsFile=%s",
-		info.repoOBSPath(), last, lfsFile,
-	)
-	if err != nil || lfsFile == "" {
+	r, err = s.engine.Sync(&SyncOption{
+		WorkDir:     tempDir,
+		CloneURL:    s.ph.GetCloneURL(info.Owner.Account(), info.RepoName),
+		Env:         s.gitEnv(),
+		RepoName:    info.RepoName,
+		Branch:      info.shortRef(),
+		OBSPath:     s.h.getRepoObsPath(s.h.refOBSPath(info)),
+		StartCommit: startCommit,
+		Abort:       abort,
+	})
+	if err != nil {
+		err = failAt(metrics.StageEngine, err)
+
 		return
 	}
 
-	err = s.syncLFSFiles(lfsFile, info)
+	s.log.Debugf("sync file for repo:%s, %s", info.String(), r.String())
 
-	return
-}
+	observeUploads(&r)
 
-func (s *syncService) syncLFSFiles(lfsFiles string, info *RepoInfo) error {
-	obsPath := info.repoOBSPath()
+	if err = s.syncLFSFiles(r.LFSFiles, info, abort); err != nil {
+		err = failAt(metrics.StageLFSCopy, err)
 
-	return utils.ReadFileLineByLine(lfsFiles, func(line string) error {
-		v := strings.Split(line, ":oid sha256:")
-		dst := filepath.Join(obsPath, v[0])
+		return
+	}
 
-		s.log.Debugf("save lfs %s to %s", v[1], dst)
+	if s.cfg.Verify {
+		if err = s.verify(info, &r); err != nil {
+			err = failAt(metrics.StageVerify, err)
 
-		return s.h.syncLFSFile(v[1], dst)
-	})
+			return
+		}
+	}
+
+	return
 }
 
-func (s *syncService) syncFile(workDir, startCommit string, info *RepoInfo) (
-	lastCommit string, lfsFile string, err error,
-) {
-	params := []string{
-		s.cfg.SyncFileShell,
-		workDir,
-		s.ph.GetCloneURL(info.Owner.Account(), info.RepoName),
-		info.RepoName, s.obsutil, s.obsBucket,
-		s.h.getRepoObsPath(info.repoOBSPath()),
-		startCommit,
+func observeUploads(r *SyncResult) {
+	for i := range r.SmallFiles {
+		metrics.UploadedBytes.Add(float64(r.SmallFiles[i].Size))
 	}
 
-	v, err, _ := utils.RunCmd(params...)
-	if err != nil {
-		err = fmt.Errorf(
-			"run sync shell, err=%s, params=%v",
-			err.Error(), params,
-		)
+	metrics.UploadedObjects.Add(float64(len(r.SmallFiles)))
 
-		return
+	for i := range r.CopiedFiles {
+		if r.CopiedFiles[i].SHA != "" {
+			metrics.LFSCopies.Inc()
+		}
 	}
+}
 
-	s.log.Debugf(
-		"sync file for repo: %s, the result for sync shell is: %s",
-		info.repoOBSPath(), v,
-	)
+func (s *syncService) verify(info *RepoInfo, r *SyncResult) error {
+	ms, err := s.v.verify(s.h.refOBSPath(info), r)
+	if err != nil {
+		return err
+	}
 
-	r := strings.Split(string(v), ", ")
-	lastCommit = r[0]
+	r.Mismatches = ms
 
-	if strings.HasPrefix(r[2], "yes") {
-		lfsFile = r[1]
+	for _, m := range ms {
+		s.log.Warnf("mismatch of repo(%s): %s", info.String(), m.String())
 	}
 
-	return
+	if len(ms) > 0 && s.cfg.FailOnMismatch {
+		return fmt.Errorf("%d objects mismatch after sync", len(ms))
+	}
+
+	return nil
+}
+
+func (s *syncService) syncLFSFiles(files []LFSFile, info *RepoInfo, abort <-chan struct{}) error {
+	obsPath := s.h.refOBSPath(info)
+
+	return utils.Parallel(s.cfg.UploadWorkers, len(files), func(i int) error {
+		if err := checkAbort(abort); err != nil {
+			return err
+		}
+
+		f := &files[i]
+		dst := filepath.Join(obsPath, f.Path)
+
+		s.log.Debugf("save lfs %s to %s", f.SHA, dst)
+
+		if err := s.h.syncLFSFile(f.SHA, dst); err != nil {
+			return err
+		}
+
+		metrics.LFSCopies.Inc()
+
+		return nil
+	})
 }
@@ -0,0 +1,97 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
+)
+
+func newShellEngine(shell, obsutil, obsBucket string, log *logrus.Entry) SyncEngine {
+	return &shellEngine{
+		shell:     shell,
+		obsutil:   obsutil,
+		obsBucket: obsBucket,
+		log:       log,
+	}
+}
+
+// shellEngine syncs files by the sync shell which depends on obsutil.
+type shellEngine struct {
+	shell     string
+	obsutil   string
+	obsBucket string
+	log       *logrus.Entry
+}
+
+func (e *shellEngine) Sync(opt *SyncOption) (r SyncResult, err error) {
+	if opt.Branch != "" {
+		err = errors.New("sync shell can only sync the default branch")
+
+		return
+	}
+
+	params := []string{
+		e.shell,
+		opt.WorkDir,
+		opt.CloneURL,
+		opt.RepoName, e.obsutil, e.obsBucket,
+		opt.OBSPath,
+		opt.StartCommit,
+	}
+
+	v, err, _ := utils.RunCmdWithAbort(opt.Abort, opt.Env, params...)
+	if err != nil {
+		if checkAbort(opt.Abort) != nil {
+			err = errSyncAborted
+
+			return
+		}
+
+		err = fmt.Errorf(
+			"run sync shell, err=%s, output=%s",
+			err.Error(), v,
+		)
+
+		return
+	}
+
+	e.log.Debugf(
+		"sync file for repo: %s, the result for sync shell is: %s",
+		opt.OBSPath, v,
+	)
+
+	// the output is like: last_commit, lfs_file, yes
+	items := strings.Split(strings.TrimSpace(string(v)), ", ")
+	if len(items) != 3 || items[0] == "" {
+		err = fmt.Errorf("invalid output of sync shell: %s", v)
+
+		return
+	}
+
+	r.LastCommit = items[0]
+
+	if items[2] == "yes" {
+		r.LFSFiles, err = e.parseLFSFiles(items[1])
+	}
+
+	return
+}
+
+func (e *shellEngine) parseLFSFiles(lfsFile string) (r []LFSFile, err error) {
+	err = utils.ReadFileLineByLine(lfsFile, func(line string) error {
+		v := strings.Split(line, ":oid sha256:")
+		if len(v) != 2 || len(v[1]) != 64 {
+			return fmt.Errorf("invalid lfs file: %s", line)
+		}
+
+		r = append(r, LFSFile{Path: v[0], SHA: v[1]})
+
+		return nil
+	})
+
+	return
+}
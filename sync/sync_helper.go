@@ -2,11 +2,18 @@ package sync
 
 import (
 	"path/filepath"
+	"strings"
 
 	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
 	"github.com/opensourceways/robot-gitlab-sync-repo/utils"
 )
 
+// retry calls f by utils.Retry and counts the retries.
+func retry(f func() error) error {
+	return utils.RetryWithHook(f, metrics.RetryAttempts.Inc)
+}
+
 type syncHelper struct {
 	obsService obs.OBS
 	cfg        HelperConfig
@@ -15,24 +22,58 @@ type syncHelper struct {
 // sha: sha
 // dst: user/[project,model,dataset]/repo_id/xxx
 func (s *syncHelper) syncLFSFile(sha, dst string) error {
-	return utils.Retry(func() error {
+	return retry(func() error {
 		return s.obsService.CopyObject(
-			filepath.Join(s.cfg.RepoPath, dst),
-			filepath.Join(s.cfg.LFSPath, sha[:2], sha[2:4], sha[4:]),
+			filepath.Join(s.cfg.RepoPath, dst), s.lfsOBSPath(sha),
 		)
 	})
 }
 
+// lfsOBSPath returns the path of lfs object whose sha256 is sha.
+func (s *syncHelper) lfsOBSPath(sha string) string {
+	return filepath.Join(s.cfg.LFSPath, sha[:2], sha[2:4], sha[4:])
+}
+
 // p: user/[project,model,dataset]/repo_id
 func (s *syncHelper) saveLastCommit(p, commit string) error {
-	return utils.Retry(func() error {
-		return s.obsService.SaveObject(
-			filepath.Join(s.cfg.RepoPath, p, s.cfg.CommitFile),
-			commit,
-		)
+	return retry(func() error {
+		return s.obsService.SaveObject(s.commitFilePath(p), commit)
 	})
 }
 
+// refOBSPath returns the path of ref which is relative to RepoPath.
+// It is generated by RepoLayout for the default branch, like user/repo_id
+// or user/[project,model,dataset]/repo_id, and by RefLayout for the others.
+func (s *syncHelper) refOBSPath(info *RepoInfo) string {
+	if info.Ref == "" {
+		return filepath.Clean(s.layoutReplacer(info).Replace(s.cfg.RepoLayout))
+	}
+
+	return filepath.Clean(s.layoutReplacer(
+		info, refLayoutRef, strings.TrimPrefix(info.Ref, "refs/"),
+	).Replace(s.cfg.RefLayout))
+}
+
+// layoutReplacer replaces the placeholders of repo and the extra ones.
+// The type of repo which is unknown is the default one.
+func (s *syncHelper) layoutReplacer(info *RepoInfo, extra ...string) *strings.Replacer {
+	t := info.Type
+	if t == nil {
+		t = s.cfg.defaultRepoType()
+	}
+
+	return strings.NewReplacer(append([]string{
+		refLayoutOwner, info.Owner.Account(),
+		refLayoutType, t.ResourceType(),
+		refLayoutRepoId, info.RepoId,
+	}, extra...)...)
+}
+
+// p: user/[project,model,dataset]/repo_id
+func (s *syncHelper) commitFilePath(p string) string {
+	return filepath.Join(s.cfg.RepoPath, p, s.cfg.CommitFile)
+}
+
 // p: user/[project,model,dataset]/repo_id
 func (s *syncHelper) getRepoObsPath(p string) string {
 	return filepath.Join(s.cfg.RepoPath, p)
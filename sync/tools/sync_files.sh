@@ -30,14 +30,25 @@ cd $work_dir
 # work_dir can't has suffix of / and must be an absolute path
 work_dir=$(pwd)
 
-git clone -q $repo_url
+# the lfs objects are copied inside obs, don't download them.
+export GIT_LFS_SKIP_SMUDGE=1
+
+# clone the last commit only, and fetch the blobs of changed files on demand.
+git clone -q --filter=blob:none --no-checkout --depth=1 $repo_url $repo_name
 cd $repo_name
 
 last_commit=$(git log --format="%H" -n 1)
 file_prefix=$work_dir/$last_commit
 
+# fetch the start commit alone, its tree is enough to diff.
+if [ -n "$start_commit" ]; then
+    git fetch -q --depth=1 --filter=blob:none origin $start_commit
+fi
+
 all_files=${file_prefix}_files
 if [ -z "$start_commit" ]; then
+    git reset -q --hard
+
     rm .git -fr
 
     find . -type f > $all_files
@@ -45,6 +56,13 @@ if [ -z "$start_commit" ]; then
 else
     git diff $start_commit..$last_commit --name-only > $all_files
 
+    changed_files=${file_prefix}_changed
+    git diff $start_commit..$last_commit --name-only --diff-filter=d -z > $changed_files
+    if [ -s $changed_files ]; then
+        GIT_LITERAL_PATHSPECS=1 git checkout -q $last_commit \
+            --pathspec-from-file=$changed_files --pathspec-file-nul
+    fi
+
     rm .git -fr
 fi
 
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+)
+
+// Mismatch is an object of obs which is not same as the file of repo.
+type Mismatch struct {
+	Path   string
+	Reason string
+}
+
+func (m Mismatch) String() string {
+	return m.Path + ": " + m.Reason
+}
+
+// verifier checks the objects of changed files by their metadata.
+type verifier struct {
+	h          *syncHelper
+	obsService obs.OBS
+}
+
+// verify: obsPath is like user/[project,model,dataset]/repo_id
+func (v *verifier) verify(obsPath string, r *SyncResult) ([]Mismatch, error) {
+	var ms []Mismatch
+
+	add := func(p, reason string, args ...interface{}) {
+		ms = append(ms, Mismatch{Path: p, Reason: fmt.Sprintf(reason, args...)})
+	}
+
+	for _, f := range r.SmallFiles {
+		meta, err := v.getMeta(filepath.Join(obsPath, f.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case meta == nil:
+			add(f.Path, "missing")
+
+		case meta.Size != f.Size:
+			add(f.Path, "size is %d, expect %d", meta.Size, f.Size)
+
+		case f.MD5 != "" && !isMultipartETag(meta.ETag) && meta.ETag != f.MD5:
+			add(f.Path, "md5 is %s, expect %s", meta.ETag, f.MD5)
+		}
+	}
+
+	for _, f := range r.LFSFiles {
+		meta, err := v.getMeta(filepath.Join(obsPath, f.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		src, err := v.obsService.GetObjectMeta(v.h.lfsOBSPath(f.SHA))
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case meta == nil:
+			add(f.Path, "missing")
+
+		case f.Size > 0 && meta.Size != f.Size:
+			add(f.Path, "size is %d, expect %d", meta.Size, f.Size)
+
+		case src != nil && isETagChanged(src.ETag, meta.ETag):
+			add(f.Path, "etag is %s, expect %s of lfs object %s", meta.ETag, src.ETag, f.SHA)
+		}
+	}
+
+	for _, f := range r.CopiedFiles {
+		meta, err := v.getMeta(filepath.Join(obsPath, f.Dst))
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case meta == nil:
+			add(f.Dst, "missing")
+
+		case f.Size > 0 && meta.Size != f.Size:
+			add(f.Dst, "size is %d, expect %d", meta.Size, f.Size)
+		}
+	}
+
+	for _, f := range r.DeletedFiles {
+		meta, err := v.getMeta(filepath.Join(obsPath, f))
+		if err != nil {
+			return nil, err
+		}
+
+		if meta != nil {
+			add(f, "not deleted")
+		}
+	}
+
+	return ms, nil
+}
+
+// isMultipartETag checks whether the etag is of the object uploaded by
+// multipart, which is not the md5 of object.
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
+
+// isETagChanged compares the etags of the copy and its source. The copy of
+// multipart object has the md5 etag, so they can't be compared if either
+// is of multipart.
+func isETagChanged(src, dst string) bool {
+	if isMultipartETag(src) || isMultipartETag(dst) {
+		return false
+	}
+
+	return src != dst
+}
+
+// getMeta: p is like user/[project,model,dataset]/repo_id/xxx
+func (v *verifier) getMeta(p string) (meta *obs.ObjectMeta, err error) {
+	err = retry(func() (err error) {
+		meta, err = v.obsService.GetObjectMeta(v.h.getRepoObsPath(p))
+
+		return
+	})
+
+	return
+}
@@ -0,0 +1,129 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain/obs"
+)
+
+const testLFSSHA = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+// metaOBS returns the metadata of objects, and the other methods are not
+// used by verifier.
+type metaOBS struct {
+	obs.OBS
+
+	metas map[string]obs.ObjectMeta
+}
+
+func (m metaOBS) GetObjectMeta(p string) (*obs.ObjectMeta, error) {
+	if v, ok := m.metas[p]; ok {
+		return &v, nil
+	}
+
+	return nil, nil
+}
+
+func TestVerify(t *testing.T) {
+	h := &syncHelper{cfg: HelperConfig{RepoPath: "repos", LFSPath: "lfs"}}
+	lfsPath := h.lfsOBSPath(testLFSSHA)
+
+	cases := []struct {
+		name  string
+		metas map[string]obs.ObjectMeta
+		r     SyncResult
+		want  []string
+	}{
+		{
+			name: "small files",
+			metas: map[string]obs.ObjectMeta{
+				"repos/o/1/a": {Size: 1, ETag: "md5a"},
+				"repos/o/1/b": {Size: 2, ETag: "md5x"},
+				"repos/o/1/c": {Size: 3, ETag: "md5x"},
+				"repos/o/1/d": {Size: 4, ETag: "multipart-2"},
+			},
+			r: SyncResult{SmallFiles: []SmallFile{
+				{Path: "a", Size: 1, MD5: "md5a"},
+				{Path: "b", Size: 1, MD5: "md5b"},
+				{Path: "c", Size: 3, MD5: "md5c"},
+				{Path: "d", Size: 4, MD5: "md5d"},
+				{Path: "e", Size: 5, MD5: "md5e"},
+			}},
+			want: []string{
+				"b: size is 2, expect 1",
+				"c: md5 is md5x, expect md5c",
+				"e: missing",
+			},
+		},
+		{
+			name: "copy of multipart lfs object",
+			metas: map[string]obs.ObjectMeta{
+				lfsPath:       {Size: 10, ETag: "multipart-3"},
+				"repos/o/1/a": {Size: 10, ETag: "md5a"},
+			},
+			r: SyncResult{LFSFiles: []LFSFile{{Path: "a", SHA: testLFSSHA, Size: 10}}},
+		},
+		{
+			name: "changed lfs object",
+			metas: map[string]obs.ObjectMeta{
+				lfsPath:       {Size: 10, ETag: "md5lfs"},
+				"repos/o/1/a": {Size: 10, ETag: "md5a"},
+			},
+			r: SyncResult{LFSFiles: []LFSFile{{Path: "a", SHA: testLFSSHA, Size: 10}}},
+			want: []string{
+				"a: etag is md5a, expect md5lfs of lfs object " + testLFSSHA,
+			},
+		},
+		{
+			name: "copied and deleted files",
+			metas: map[string]obs.ObjectMeta{
+				"repos/o/1/a": {Size: 10},
+				"repos/o/1/c": {Size: 1},
+			},
+			r: SyncResult{
+				CopiedFiles:  []CopiedFile{{Dst: "a", Size: 10}, {Dst: "b", Size: 1}},
+				DeletedFiles: []string{"c", "d"},
+			},
+			want: []string{"b: missing", "c: not deleted"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h.obsService = metaOBS{metas: c.metas}
+			v := verifier{h: h, obsService: h.obsService}
+
+			ms, err := v.verify("o/1", &c.r)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			var got []string
+			for _, m := range ms {
+				got = append(got, m.String())
+			}
+
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestToHistoryMismatches(t *testing.T) {
+	ms := make([]Mismatch, maxHistoryMismatches+2)
+	for i := range ms {
+		ms[i] = Mismatch{Path: "a", Reason: "missing"}
+	}
+
+	v := toHistoryMismatches(ms)
+
+	if len(v) != maxHistoryMismatches+1 || v[0] != "a: missing" || v[len(v)-1] != "and 2 more" {
+		t.Fatalf("unexpected mismatches: %d, %q", len(v), v[len(v)-1])
+	}
+
+	if v := toHistoryMismatches(nil); len(v) != 0 {
+		t.Fatalf("got %q, want empty", v)
+	}
+}
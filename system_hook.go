@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/domain"
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
+	"github.com/opensourceways/robot-gitlab-sync-repo/sync"
+)
+
+const (
+	headerGitlabEvent = "X-Gitlab-Event"
+	headerGitlabToken = "X-Gitlab-Token"
+
+	gitlabSystemHook = "System Hook"
+
+	eventPush            = "push"
+	eventTagPush         = "tag_push"
+	eventProjectDestroy  = "project_destroy"
+	eventProjectRename   = "project_rename"
+	eventProjectTransfer = "project_transfer"
+)
+
+// systemHookEvent is the fields of gitlab system hook used by robot.
+type systemHookEvent struct {
+	EventName string `json:"event_name"`
+	ProjectId int    `json:"project_id"`
+
+	// the fields of tag push
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Project struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"project"`
+
+	// the fields of project destroy, rename and transfer
+	PathWithNamespace    string `json:"path_with_namespace"`
+	OldPathWithNamespace string `json:"old_path_with_namespace"`
+}
+
+func newSystemHook(token string, bot *robot, log *logrus.Entry) *systemHook {
+	return &systemHook{
+		token: token,
+		bot:   bot,
+		log:   log,
+	}
+}
+
+type systemHook struct {
+	token string
+	bot   *robot
+	log   *logrus.Entry
+}
+
+func (h *systemHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	token := r.Header.Get(headerGitlabToken)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+
+		return
+	}
+
+	if r.Header.Get(headerGitlabEvent) != gitlabSystemHook {
+		http.Error(w, "not a system hook", http.StatusBadRequest)
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+
+		return
+	}
+
+	e := new(systemHookEvent)
+	if err := json.Unmarshal(body, e); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+
+		return
+	}
+
+	metrics.Events.WithLabelValues(e.EventName).Inc()
+
+	log := h.log.WithFields(logrus.Fields{
+		"event":   e.EventName,
+		"project": e.ProjectId,
+	})
+
+	if err := h.handle(e, log); err != nil {
+		log.Errorf("handle system hook failed, err:%s", err.Error())
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *systemHook) handle(e *systemHookEvent, log *logrus.Entry) error {
+	repoId := strconv.Itoa(e.ProjectId)
+
+	switch e.EventName {
+	case eventTagPush:
+		owner, err := domain.NewAccount(e.Project.Namespace)
+		if err != nil {
+			return err
+		}
+
+		return h.bot.handleRefChange(
+			&sync.RepoInfo{
+				Owner:    owner,
+				RepoId:   repoId,
+				RepoName: e.Project.Name,
+				Ref:      e.Ref,
+			},
+			e.After == zeroCommit,
+		)
+
+	case eventProjectDestroy:
+		// the path is like group/subgroup/project.
+		return h.bot.deleteRepo(
+			path.Base(path.Dir(e.PathWithNamespace)), repoId,
+		)
+
+	case eventProjectRename, eventProjectTransfer:
+		log.Infof(
+			"project is moved from %s to %s",
+			e.OldPathWithNamespace, e.PathWithNamespace,
+		)
+
+		return h.bot.moveRepo(repoId)
+
+	default:
+		log.Debug("ignore the system hook")
+	}
+
+	return nil
+}
@@ -1,8 +1,27 @@
 package utils
 
-import "os/exec"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
 
 func RunCmd(args ...string) ([]byte, error, int) {
+	return RunCmdWithEnv(nil, args...)
+}
+
+// RunCmdWithEnv runs the command with the environment variables added.
+// The secrets are redacted from the returned error and the output of
+// failed command.
+func RunCmdWithEnv(env []string, args ...string) ([]byte, error, int) {
+	return RunCmdWithAbort(nil, env, args...)
+}
+
+// RunCmdWithAbort is the same as RunCmdWithEnv except that the command is
+// killed once abort is closed.
+func RunCmdWithAbort(abort <-chan struct{}, env []string, args ...string) ([]byte, error, int) {
 	n := len(args)
 	if n == 0 {
 		return nil, nil, 0
@@ -16,15 +35,39 @@ func RunCmd(args ...string) ([]byte, error, int) {
 		args = nil
 	}
 
-	c := exec.Command(cmd, args...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if abort != nil {
+		go func() {
+			select {
+			case <-abort:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	c := exec.CommandContext(ctx, cmd, args...)
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+
 	out, err := c.CombinedOutput()
 	if err == nil {
 		return out, nil, 0
 	}
 
+	code := -1
 	if e, ok := err.(*exec.ExitError); ok {
-		return out, err, e.ExitCode()
+		code = e.ExitCode()
 	}
 
-	return out, err, -1
+	err = fmt.Errorf(
+		"run %s failed, err:%s",
+		Redact(strings.Join(append([]string{cmd}, args...), " ")),
+		Redact(err.Error()),
+	)
+
+	return []byte(Redact(string(out))), err, code
 }
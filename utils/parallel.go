@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Parallel calls f with 0 to n-1 by the workers and returns the first error.
+// The calls which have not started are skipped once an error happens.
+func Parallel(workers, n int, f func(int) error) error {
+	if workers > n {
+		workers = n
+	}
+
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		next int
+		err  error
+	)
+
+	worker := func() {
+		defer wg.Done()
+
+		for {
+			mu.Lock()
+			if err != nil || next >= n {
+				mu.Unlock()
+
+				return
+			}
+
+			i := next
+			next++
+			mu.Unlock()
+
+			if e := f(i); e != nil {
+				mu.Lock()
+				if err == nil {
+					err = e
+				}
+				mu.Unlock()
+			}
+		}
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+
+	wg.Wait()
+
+	return err
+}
+
+// RateLimiter limits the bytes sent per second by all the callers.
+// A nil RateLimiter means no limit.
+type RateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// NewRateLimiter returns nil if bytesPerSecond is not positive.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{rate: float64(bytesPerSecond)}
+}
+
+// Wait blocks until n bytes can be sent. It books the bytes at once, so
+// the large content should be read by NewLimitedReader instead.
+func (l *RateLimiter) Wait(n int64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+
+	l.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// NewLimitedReader returns the reader which calls l.Wait with the number
+// of bytes read from r each time. It returns r if l is nil.
+func NewLimitedReader(r io.Reader, l interface{ Wait(int64) }) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReader{r: r, l: l}
+}
+
+type limitedReader struct {
+	r io.Reader
+	l interface{ Wait(int64) }
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.l.Wait(int64(n))
+	}
+
+	return n, err
+}
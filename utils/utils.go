@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"time"
@@ -12,6 +13,14 @@ func GenMD5(b []byte) string {
 	return fmt.Sprintf("%x", md5.Sum(b))
 }
 
+// GenMD5Base64 generates the md5 encoded by base64 which is
+// the format of Content-MD5 header.
+func GenMD5Base64(b []byte) string {
+	v := md5.Sum(b)
+
+	return base64.StdEncoding.EncodeToString(v[:])
+}
+
 func ReadFileLineByLine(filename string, handle func(string) error) error {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -30,7 +39,13 @@ func ReadFileLineByLine(filename string, handle func(string) error) error {
 	return nil
 }
 
-func Retry(f func() error) (err error) {
+func Retry(f func() error) error {
+	return RetryWithHook(f, nil)
+}
+
+// RetryWithHook is same as Retry except that onRetry is called before
+// each retry if it is not nil.
+func RetryWithHook(f func() error, onRetry func()) (err error) {
 	if err = f(); err == nil {
 		return
 	}
@@ -42,6 +57,10 @@ func Retry(f func() error) (err error) {
 		time.Sleep(t)
 		t += m
 
+		if onRetry != nil {
+			onRetry()
+		}
+
 		if err = f(); err == nil {
 			return
 		}
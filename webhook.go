@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/opensourceways/robot-gitlab-sync-repo/metrics"
+)
+
+const (
+	eventRepoDelete = "repo_delete"
+	eventRepoMove   = "repo_move"
+)
+
+type webhookConfig struct {
+	// Path is the url path to receive the webhooks.
+	Path string `json:"path"`
+
+	// Secret is used to verify the signature of webhooks.
+	Secret string `json:"secret"`
+}
+
+func (cfg *webhookConfig) SetDefault() {
+	if cfg.Path == "" {
+		cfg.Path = "/webhook"
+	}
+}
+
+// webhookEvent is the event converted from the webhook of platform.
+type webhookEvent struct {
+	kind   string
+	repoId string
+
+	// the fields of push
+	owner         string
+	repoName      string
+	ref           string
+	defaultBranch string
+	deleted       bool
+}
+
+// webhookAdapter converts the webhooks of a platform.
+type webhookAdapter interface {
+	verify(h http.Header, body []byte, secret string) bool
+	// parse returns nil if the event is not handled.
+	parse(h http.Header, body []byte) (*webhookEvent, error)
+}
+
+func newWebhookAdapter(platform string) webhookAdapter {
+	switch platform {
+	case platformGitHub:
+		return githubAdapter{}
+	case platformGitea:
+		return giteaAdapter{}
+	case platformGitee:
+		return giteeAdapter{}
+	default:
+		return nil
+	}
+}
+
+func newWebhook(cfg *webhookConfig, a webhookAdapter, bot *robot, log *logrus.Entry) *webhook {
+	return &webhook{
+		secret:  cfg.Secret,
+		adapter: a,
+		bot:     bot,
+		log:     log,
+	}
+}
+
+type webhook struct {
+	secret  string
+	adapter webhookAdapter
+	bot     *robot
+	log     *logrus.Entry
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+
+		return
+	}
+
+	if !h.adapter.verify(r.Header, body, h.secret) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+
+		return
+	}
+
+	e, err := h.adapter.parse(r.Header, body)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+
+		return
+	}
+
+	if e == nil {
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	metrics.Events.WithLabelValues(e.kind).Inc()
+
+	log := h.log.WithFields(logrus.Fields{
+		"event": e.kind,
+		"repo":  e.repoId,
+	})
+
+	if err := h.handle(e); err != nil {
+		log.Errorf("handle webhook failed, err:%s", err.Error())
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *webhook) handle(e *webhookEvent) error {
+	switch e.kind {
+	case eventPush:
+		info, err := newPushRepoInfo(e.owner, e.repoId, e.repoName, e.ref, e.defaultBranch)
+		if err != nil {
+			return err
+		}
+
+		return h.bot.handleRefChange(&info, e.deleted)
+
+	case eventRepoDelete:
+		return h.bot.deleteRepo(e.owner, e.repoId)
+
+	case eventRepoMove:
+		return h.bot.moveRepo(e.repoId)
+	}
+
+	return nil
+}
+
+// hmacSHA256 returns the hex of hmac-sha256 of body.
+func hmacSHA256(body []byte, secret string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	headerGiteaEvent     = "X-Gitea-Event"
+	headerGiteaSignature = "X-Gitea-Signature"
+
+	giteaEventPush       = "push"
+	giteaEventDelete     = "delete"
+	giteaEventRepository = "repository"
+
+	giteaRefTypeTag = "tag"
+)
+
+type giteaRepo struct {
+	Id            int64  `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+type giteaEvent struct {
+	// Ref is the full name in push event and the short name in delete event.
+	Ref        string    `json:"ref"`
+	RefType    string    `json:"ref_type"`
+	After      string    `json:"after"`
+	Action     string    `json:"action"`
+	Repository giteaRepo `json:"repository"`
+}
+
+type giteaAdapter struct{}
+
+func (a giteaAdapter) verify(h http.Header, body []byte, secret string) bool {
+	return hmac.Equal([]byte(hmacSHA256(body, secret)), []byte(h.Get(headerGiteaSignature)))
+}
+
+func (a giteaAdapter) parse(h http.Header, body []byte) (*webhookEvent, error) {
+	t := h.Get(headerGiteaEvent)
+	if t != giteaEventPush && t != giteaEventDelete && t != giteaEventRepository {
+		return nil, nil
+	}
+
+	e := new(giteaEvent)
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, err
+	}
+
+	r := &webhookEvent{
+		repoId: strconv.FormatInt(e.Repository.Id, 10),
+	}
+
+	if t == giteaEventRepository {
+		if e.Action != "deleted" {
+			return nil, nil
+		}
+
+		r.kind = eventRepoDelete
+
+		return r, nil
+	}
+
+	r.kind = eventPush
+	r.owner = e.Repository.Owner.Login
+	r.repoName = e.Repository.Name
+	r.defaultBranch = e.Repository.DefaultBranch
+
+	if t == giteaEventPush {
+		r.ref = e.Ref
+		r.deleted = e.After == zeroCommit
+	} else {
+		r.ref = refBranchPrefix + e.Ref
+		if e.RefType == giteaRefTypeTag {
+			r.ref = refTagPrefix + e.Ref
+		}
+
+		r.deleted = true
+	}
+
+	return r, nil
+}
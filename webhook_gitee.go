@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	headerGiteeEvent     = "X-Gitee-Event"
+	headerGiteeToken     = "X-Gitee-Token"
+	headerGiteeTimestamp = "X-Gitee-Timestamp"
+
+	giteeEventPush    = "Push Hook"
+	giteeEventTagPush = "Tag Push Hook"
+
+	// giteeTimestampWindow is the max difference between the timestamp
+	// of signed event and now, so that the event can't be replayed later.
+	giteeTimestampWindow = 5 * time.Minute
+)
+
+type giteeEvent struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		Id            int64  `json:"id"`
+		Path          string `json:"path"`
+		Namespace     string `json:"namespace"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+type giteeAdapter struct{}
+
+// verify checks the token which is the secret itself, or the signature
+// of timestamp if the signing key is used. The timestamp is milliseconds
+// and it must be recent.
+func (a giteeAdapter) verify(h http.Header, body []byte, secret string) bool {
+	v := secret
+
+	if ts := h.Get(headerGiteeTimestamp); ts != "" {
+		ms, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return false
+		}
+
+		d := time.Since(time.Unix(0, ms*int64(time.Millisecond)))
+		if d > giteeTimestampWindow || d < -giteeTimestampWindow {
+			return false
+		}
+
+		m := hmac.New(sha256.New, []byte(secret))
+		m.Write([]byte(ts + "\n" + secret))
+
+		v = base64.StdEncoding.EncodeToString(m.Sum(nil))
+	}
+
+	return hmac.Equal([]byte(v), []byte(h.Get(headerGiteeToken)))
+}
+
+func (a giteeAdapter) parse(h http.Header, body []byte) (*webhookEvent, error) {
+	t := h.Get(headerGiteeEvent)
+	if t != giteeEventPush && t != giteeEventTagPush {
+		return nil, nil
+	}
+
+	e := new(giteeEvent)
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, err
+	}
+
+	return &webhookEvent{
+		kind:          eventPush,
+		repoId:        strconv.FormatInt(e.Repository.Id, 10),
+		owner:         e.Repository.Namespace,
+		repoName:      e.Repository.Path,
+		ref:           e.Ref,
+		defaultBranch: e.Repository.DefaultBranch,
+		deleted:       e.Deleted || e.After == zeroCommit,
+	}, nil
+}
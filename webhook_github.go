@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	headerGitHubEvent     = "X-GitHub-Event"
+	headerGitHubSignature = "X-Hub-Signature-256"
+
+	githubEventPush       = "push"
+	githubEventRepository = "repository"
+)
+
+type githubRepo struct {
+	Id            int64  `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+type githubEvent struct {
+	Ref        string     `json:"ref"`
+	Deleted    bool       `json:"deleted"`
+	Action     string     `json:"action"`
+	Repository githubRepo `json:"repository"`
+}
+
+type githubAdapter struct{}
+
+func (a githubAdapter) verify(h http.Header, body []byte, secret string) bool {
+	v := "sha256=" + hmacSHA256(body, secret)
+
+	return hmac.Equal([]byte(v), []byte(h.Get(headerGitHubSignature)))
+}
+
+func (a githubAdapter) parse(h http.Header, body []byte) (*webhookEvent, error) {
+	t := h.Get(headerGitHubEvent)
+	if t != githubEventPush && t != githubEventRepository {
+		return nil, nil
+	}
+
+	e := new(githubEvent)
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, err
+	}
+
+	r := &webhookEvent{
+		repoId: strconv.FormatInt(e.Repository.Id, 10),
+	}
+
+	if t == githubEventPush {
+		r.kind = eventPush
+		r.owner = e.Repository.Owner.Login
+		r.repoName = e.Repository.Name
+		r.ref = e.Ref
+		r.defaultBranch = e.Repository.DefaultBranch
+		r.deleted = e.Deleted
+
+		return r, nil
+	}
+
+	switch e.Action {
+	case "deleted":
+		r.kind = eventRepoDelete
+	case "renamed", "transferred":
+		r.kind = eventRepoMove
+	default:
+		return nil, nil
+	}
+
+	return r, nil
+}
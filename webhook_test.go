@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	// the example of the webhook docs of github.
+	testSecret    = "It's a Secret to Everybody"
+	testPayload   = "Hello, World!"
+	testSignature = "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+)
+
+func header(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+
+	return h
+}
+
+func giteeSign(ts, secret string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts + "\n" + secret))
+
+	return base64.StdEncoding.EncodeToString(m.Sum(nil))
+}
+
+func msOf(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	now := msOf(time.Now())
+	old := msOf(time.Now().Add(-time.Hour))
+	future := msOf(time.Now().Add(time.Hour))
+
+	cases := []struct {
+		name    string
+		adapter webhookAdapter
+		header  http.Header
+		body    string
+		want    bool
+	}{
+		{
+			name:    "github",
+			adapter: githubAdapter{},
+			header:  header(headerGitHubSignature, "sha256="+testSignature),
+			body:    testPayload,
+			want:    true,
+		},
+		{
+			name:    "github tampered payload",
+			adapter: githubAdapter{},
+			header:  header(headerGitHubSignature, "sha256="+testSignature),
+			body:    testPayload + " ",
+		},
+		{
+			name:    "github without prefix",
+			adapter: githubAdapter{},
+			header:  header(headerGitHubSignature, testSignature),
+			body:    testPayload,
+		},
+		{
+			name:    "github without signature",
+			adapter: githubAdapter{},
+			header:  header(),
+			body:    testPayload,
+		},
+		{
+			name:    "gitea",
+			adapter: giteaAdapter{},
+			header:  header(headerGiteaSignature, testSignature),
+			body:    testPayload,
+			want:    true,
+		},
+		{
+			name:    "gitea tampered payload",
+			adapter: giteaAdapter{},
+			header:  header(headerGiteaSignature, testSignature),
+			body:    "Hello, World?",
+		},
+		{
+			name:    "gitee password",
+			adapter: giteeAdapter{},
+			header:  header(headerGiteeToken, testSecret),
+			want:    true,
+		},
+		{
+			name:    "gitee wrong password",
+			adapter: giteeAdapter{},
+			header:  header(headerGiteeToken, testSecret+"x"),
+		},
+		{
+			name:    "gitee signature",
+			adapter: giteeAdapter{},
+			header: header(
+				headerGiteeTimestamp, now, headerGiteeToken, giteeSign(now, testSecret),
+			),
+			want: true,
+		},
+		{
+			name:    "gitee signature of other timestamp",
+			adapter: giteeAdapter{},
+			header: header(
+				headerGiteeTimestamp, now, headerGiteeToken, giteeSign(old, testSecret),
+			),
+		},
+		{
+			name:    "gitee replayed signature",
+			adapter: giteeAdapter{},
+			header: header(
+				headerGiteeTimestamp, old, headerGiteeToken, giteeSign(old, testSecret),
+			),
+		},
+		{
+			name:    "gitee signature from future",
+			adapter: giteeAdapter{},
+			header: header(
+				headerGiteeTimestamp, future, headerGiteeToken, giteeSign(future, testSecret),
+			),
+		},
+		{
+			name:    "gitee invalid timestamp",
+			adapter: giteeAdapter{},
+			header: header(
+				headerGiteeTimestamp, "now", headerGiteeToken, giteeSign("now", testSecret),
+			),
+		},
+		{
+			name:    "gitee password as signature",
+			adapter: giteeAdapter{},
+			header:  header(headerGiteeTimestamp, now, headerGiteeToken, testSecret),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := c.adapter.verify(c.header, []byte(c.body), testSecret); v != c.want {
+				t.Fatalf("verify = %v, want %v", v, c.want)
+			}
+		})
+	}
+}